@@ -339,9 +339,11 @@ var staticSuites = testSuites{
 			},
 			SyntheticEventTests: ginkgo.JUnitForEventsFunc(synthetictests.StableSystemEventInvariants),
 		},
-		PreSuite: suiteWithKubeTestInitializationPreSuite,
+		PreSuite: csiSuitePreSuite,
 		PostSuite: func(opt *runOptions) {
 			printStorageCapabilities(opt.Out)
+			cleanupLeakedStorage(opt)
+			writeStorageSkipReport(opt)
 		},
 	},
 	{
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/image/reference"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	k8simage "k8s.io/kubernetes/test/utils/image"
+)
+
+// TestStorageImagesAreMirrored checks that the images of the storage test
+// pods are part of the mirror mappings, so that --from-repository also covers
+// the storage suites on disconnected clusters.
+func TestStorageImagesAreMirrored(t *testing.T) {
+	ref, err := reference.Parse("mirror.example.com:5000/e2e/images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := createImageMirrorForInternalImages("", ref, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range []string{
+		e2epod.GetDefaultTestImage(),
+		k8simage.GetE2EImage(k8simage.JessieDnsutils),
+		k8simage.GetE2EImage(k8simage.VolumeNFSServer),
+	} {
+		var found bool
+		for _, line := range lines {
+			if strings.HasPrefix(line, image+" mirror.example.com:5000/e2e/images:") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("image %s is not mirrored: %v", image, lines)
+		}
+	}
+}
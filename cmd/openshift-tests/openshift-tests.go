@@ -15,6 +15,7 @@ import (
 
 	"github.com/openshift/origin/pkg/monitor/monitor_cmd"
 
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 
 	"github.com/onsi/ginkgo"
@@ -26,6 +27,7 @@ import (
 	"k8s.io/component-base/logs"
 	"k8s.io/klog/v2"
 	"k8s.io/kubectl/pkg/util/templates"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
 
 	"github.com/openshift/origin/pkg/monitor"
 	"github.com/openshift/origin/pkg/monitor/resourcewatch/cmd"
@@ -216,9 +218,20 @@ type runOptions struct {
 	UpgradeSuite string
 	ToImage      string
 	TestOptions  []string
+	// RunID replaces the ID that labels the namespaces of each test
+	// process, so that all namespaces of the run share it
+	RunID string
+	// StorageTestPlan is the file that the storage tests record
+	// themselves in instead of running
+	StorageTestPlan string
+	// StorageSkipReport is the file that the report of the storage tests
+	// skipped because of their driver or pattern is written to
+	StorageSkipReport string
 
 	// Shared by initialization code
-	config *cluster.ClusterConfiguration
+	config             *cluster.ClusterConfiguration
+	runNamespaces      *runNamespaceRecorder
+	storageSkipRecords string
 }
 
 func NewRunOptions(fromRepository string) *runOptions {
@@ -235,6 +248,9 @@ func (opt *runOptions) AsEnv() []string {
 	args = append(args, fmt.Sprintf("KUBE_TEST_REPO=%s", opt.FromRepository))
 	args = append(args, fmt.Sprintf("TEST_PROVIDER=%s", opt.Provider))
 	args = append(args, fmt.Sprintf("TEST_JUNIT_DIR=%s", opt.JUnitDir))
+	args = append(args, fmt.Sprintf("TEST_RUN_ID=%s", opt.RunID))
+	args = append(args, fmt.Sprintf("%s=%s", storageTestPlanEnv, opt.StorageTestPlan))
+	args = append(args, fmt.Sprintf("%s=%s", storageSkipRecordsEnv, opt.storageSkipRecords))
 	for i := 10; i > 0; i-- {
 		if klog.V(klog.Level(i)).Enabled() {
 			args = append(args, fmt.Sprintf("TEST_LOG_LEVEL=%d", i))
@@ -421,6 +437,10 @@ func newRunTestCommand() *cobra.Command {
 			if v := os.Getenv("TEST_LOG_LEVEL"); len(v) > 0 {
 				cmd.Flags().Lookup("v").Value.Set(v)
 			}
+			if v := os.Getenv("TEST_RUN_ID"); len(v) > 0 {
+				e2e.RunID = types.UID(v)
+			}
+			setStorageTestOptionsFromEnv()
 
 			if err := verifyImagesWithoutEnv(); err != nil {
 				return err
@@ -448,6 +468,16 @@ func newRunTestCommand() *cobra.Command {
 			}
 
 			exutil.WithCleanup(func() { err = testOpt.Run(args) })
+			if !testOpt.DryRun {
+				// The upstream AfterSuite hooks are cleared above, so the
+				// storage classes that the test leaked are checked here.
+				if leakErr := verifyNoLeakedStorageClasses(); leakErr != nil {
+					fmt.Fprintf(testOpt.ErrOut, "fail: %v\n", leakErr)
+					if err == nil {
+						err = testginkgo.ExitError{Code: 1}
+					}
+				}
+			}
 			return err
 		},
 	}
@@ -482,6 +512,8 @@ func mirrorToFile(opt *testginkgo.Options, fn func() error) error {
 func bindOptions(opt *runOptions, flags *pflag.FlagSet) {
 	flags.StringVar(&opt.FromRepository, "from-repository", opt.FromRepository, "A container image repository to retrieve test images from.")
 	flags.StringVar(&opt.Provider, "provider", opt.Provider, "The cluster infrastructure provider. Will automatically default to the correct value.")
+	flags.StringVar(&opt.StorageTestPlan, "storage-test-plan", opt.StorageTestPlan, "If set, storage tests are not executed; instead, each test appends a JSON line with its name and whether it would be skipped to this file.")
+	flags.StringVar(&opt.StorageSkipReport, "storage-skip-report", opt.StorageSkipReport, "If set, the openshift/csi suite writes a JSON report of the storage tests that were skipped because of their driver or pattern to this file.")
 	bindTestOptions(&opt.Options, flags)
 }
 
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+)
+
+const (
+	// storageCleanupTimeout bounds how long the end of a CSI suite run waits
+	// for leaked volumes and snapshots to be deleted from the storage backend.
+	storageCleanupTimeout = 10 * time.Minute
+
+	// e2eRunLabel is the namespace label that carries the run ID of the
+	// test that created the namespace.
+	e2eRunLabel = "e2e-run"
+)
+
+var volumeSnapshotContentGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotcontents"}
+
+// leakedStorageObject is a PersistentVolume or VolumeSnapshotContent that a
+// test of the current run left behind.
+type leakedStorageObject struct {
+	Kind      string
+	Name      string
+	Driver    string
+	Namespace string
+}
+
+func (o leakedStorageObject) String() string {
+	return fmt.Sprintf("%s %s (driver %s, namespace %s)", o.Kind, o.Name, o.Driver, o.Namespace)
+}
+
+// verifyNoLeakedStorageClasses deletes the storage classes that the test in
+// this process created with the storage framework and did not clean up, and
+// returns an error that names them.
+func verifyNoLeakedStorageClasses() error {
+	client, err := e2e.LoadClientset()
+	if err != nil {
+		return fmt.Errorf("unable to check for leaked storage classes: %v", err)
+	}
+	return storageframework.VerifyNoLeakedStorageClasses(client)
+}
+
+// csiSuitePreSuite initializes the openshift/csi suite, assigns the run an
+// ID and starts recording the namespaces that carry it, so that the
+// namespaces of all its tests can be recognized when the suite ends, even
+// once they are deleted.  It also creates the file for the
+// skip records of the tests when a skip report was requested.
+func csiSuitePreSuite(opt *runOptions) error {
+	if err := suiteWithKubeTestInitializationPreSuite(opt); err != nil {
+		return err
+	}
+	opt.RunID = string(uuid.NewUUID())
+	if opt.DryRun {
+		return nil
+	}
+	if err := startStorageSkipRecords(opt); err != nil {
+		return err
+	}
+	client, err := e2e.LoadClientset()
+	if err != nil {
+		return err
+	}
+	opt.runNamespaces = newRunNamespaceRecorder(client, opt.RunID)
+	return nil
+}
+
+// runNamespaceRecorder records the names of the namespaces that are created
+// with the run's label while the run is going on.
+type runNamespaceRecorder struct {
+	lock  sync.Mutex
+	names sets.String
+	stop  chan struct{}
+}
+
+func newRunNamespaceRecorder(client kubernetes.Interface, runID string) *runNamespaceRecorder {
+	r := &runNamespaceRecorder{
+		names: sets.NewString(),
+		stop:  make(chan struct{}),
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = labels.SelectorFromSet(labels.Set{e2eRunLabel: runID}).String()
+	}))
+	factory.Core().V1().Namespaces().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				r.lock.Lock()
+				defer r.lock.Unlock()
+				r.names.Insert(ns.Name)
+			}
+		},
+	})
+	factory.Start(r.stop)
+	return r
+}
+
+// Stop stops recording and returns the names of the recorded namespaces.
+func (r *runNamespaceRecorder) Stop() sets.String {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	return sets.NewString(r.names.UnsortedList()...)
+}
+
+// cleanupLeakedStorage deletes the volumes and snapshots of the drivers under
+// test that the tests of this run provisioned but did not delete, and reports
+// what it had to clean.  Leaked objects cost money and count against the
+// quota of the cloud accounts that CI shares, so any that survive the deadline
+// are listed for manual cleanup.
+func cleanupLeakedStorage(opt *runOptions) {
+	if opt.DryRun || len(opt.RunID) == 0 || opt.runNamespaces == nil {
+		return
+	}
+	out := opt.Out
+	namespaces := opt.runNamespaces.Stop()
+
+	drivers, err := csiDriverNames()
+	if err != nil {
+		fmt.Fprintf(out, "Unable to check for leaked storage: %v\n", err)
+		return
+	}
+	if drivers.Len() == 0 {
+		return
+	}
+	clientConfig, err := e2e.LoadConfig(true)
+	if err != nil {
+		fmt.Fprintf(out, "Unable to check for leaked storage: %v\n", err)
+		return
+	}
+	kubeClient, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		fmt.Fprintf(out, "Unable to check for leaked storage: %v\n", err)
+		return
+	}
+	dynamicClient, err := dynamic.NewForConfig(clientConfig)
+	if err != nil {
+		fmt.Fprintf(out, "Unable to check for leaked storage: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageCleanupTimeout)
+	defer cancel()
+
+	owned := newRunNamespaceFilter(kubeClient, opt.RunID, namespaces)
+	leaked, err := findLeakedPersistentVolumes(ctx, kubeClient, drivers, owned)
+	if err != nil {
+		fmt.Fprintf(out, "Unable to check for leaked persistent volumes: %v\n", err)
+	}
+	snapshots, err := findLeakedVolumeSnapshotContents(ctx, dynamicClient, drivers, owned)
+	if err != nil {
+		fmt.Fprintf(out, "Unable to check for leaked volume snapshots: %v\n", err)
+	}
+	leaked = append(leaked, snapshots...)
+	if len(leaked) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Cleaning up %d storage objects leaked by the tests:\n", len(leaked))
+	for _, o := range leaked {
+		fmt.Fprintf(out, "  %s\n", o)
+		if err := deleteLeakedStorageObject(ctx, kubeClient, dynamicClient, o); err != nil {
+			fmt.Fprintf(out, "    failed to delete: %v\n", err)
+		}
+	}
+
+	remaining := waitForLeakedStorageDeletion(ctx, kubeClient, dynamicClient, leaked)
+	if len(remaining) == 0 {
+		fmt.Fprintf(out, "Deleted all %d leaked storage objects\n", len(leaked))
+		fmt.Fprintln(out)
+		return
+	}
+	fmt.Fprintf(out, "%d leaked storage objects were not deleted within %v and must be cleaned up manually:\n", len(remaining), storageCleanupTimeout)
+	for _, o := range remaining {
+		fmt.Fprintf(out, "  %s\n", o)
+	}
+	fmt.Fprintln(out)
+}
+
+// csiDriverNames returns the names of the drivers in the test manifests.
+func csiDriverNames() (sets.String, error) {
+	drivers := sets.NewString()
+	for _, manifestFilename := range strings.Split(os.Getenv(manifestEnvVar), ",") {
+		if len(manifestFilename) == 0 {
+			continue
+		}
+		yamlFile, err := ioutil.ReadFile(manifestFilename)
+		if err != nil {
+			return nil, err
+		}
+		var yamlManifest YamlManifest
+		if err := yaml.Unmarshal(yamlFile, &yamlManifest); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", manifestFilename, err)
+		}
+		if len(yamlManifest.DriverInfo.Name) > 0 {
+			drivers.Insert(yamlManifest.DriverInfo.Name)
+		}
+	}
+	return drivers, nil
+}
+
+// runNamespaceFilter decides whether a namespace belonged to a test of the
+// current run.  Namespaces that still exist must carry the run's label.  The
+// namespaces of most tests are gone by the end of the run, so for those the
+// run must have recorded them.  Objects of any other namespace, including
+// namespaces that others deleted during the run, are never touched.
+type runNamespaceFilter struct {
+	client   kubernetes.Interface
+	runID    string
+	recorded sets.String
+	cache    map[string]*corev1.Namespace
+}
+
+func newRunNamespaceFilter(client kubernetes.Interface, runID string, recorded sets.String) *runNamespaceFilter {
+	return &runNamespaceFilter{
+		client:   client,
+		runID:    runID,
+		recorded: recorded,
+		cache:    map[string]*corev1.Namespace{},
+	}
+}
+
+func (f *runNamespaceFilter) owns(ctx context.Context, namespace string) (bool, error) {
+	ns, ok := f.cache[namespace]
+	if !ok {
+		var err error
+		ns, err = f.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			ns, err = nil, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		f.cache[namespace] = ns
+	}
+	if ns == nil {
+		return f.recorded.Has(namespace), nil
+	}
+	return ns.Labels[e2eRunLabel] == f.runID, nil
+}
+
+// findLeakedPersistentVolumes returns the volumes of drivers that were
+// provisioned for claims in namespaces of the current run.
+func findLeakedPersistentVolumes(ctx context.Context, client kubernetes.Interface, drivers sets.String, owned *runNamespaceFilter) ([]leakedStorageObject, error) {
+	pvs, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var leaked []leakedStorageObject
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || !drivers.Has(pv.Spec.CSI.Driver) || pv.Spec.ClaimRef == nil {
+			continue
+		}
+		ok, err := owned.owns(ctx, pv.Spec.ClaimRef.Namespace)
+		if err != nil {
+			return leaked, err
+		}
+		if ok {
+			leaked = append(leaked, leakedStorageObject{Kind: "PersistentVolume", Name: pv.Name, Driver: pv.Spec.CSI.Driver, Namespace: pv.Spec.ClaimRef.Namespace})
+		}
+	}
+	return leaked, nil
+}
+
+// findLeakedVolumeSnapshotContents returns the snapshots of drivers that were
+// taken for VolumeSnapshots in namespaces of the current run.
+func findLeakedVolumeSnapshotContents(ctx context.Context, client dynamic.Interface, drivers sets.String, owned *runNamespaceFilter) ([]leakedStorageObject, error) {
+	contents, err := client.Resource(volumeSnapshotContentGVR).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		// The cluster does not support snapshots.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var leaked []leakedStorageObject
+	for _, content := range contents.Items {
+		spec, _ := content.Object["spec"].(map[string]interface{})
+		driver, _ := spec["driver"].(string)
+		ref, _ := spec["volumeSnapshotRef"].(map[string]interface{})
+		namespace, _ := ref["namespace"].(string)
+		if !drivers.Has(driver) || len(namespace) == 0 {
+			continue
+		}
+		ok, err := owned.owns(ctx, namespace)
+		if err != nil {
+			return leaked, err
+		}
+		if ok {
+			leaked = append(leaked, leakedStorageObject{Kind: "VolumeSnapshotContent", Name: content.GetName(), Driver: driver, Namespace: namespace})
+		}
+	}
+	return leaked, nil
+}
+
+// deleteLeakedStorageObject makes sure that deleting the object also deletes
+// the volume or snapshot in the storage backend, then deletes it.  Released
+// volumes are deleted by the PV controller once their reclaim policy is
+// Delete, so they are not deleted directly.
+func deleteLeakedStorageObject(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface, o leakedStorageObject) error {
+	switch o.Kind {
+	case "PersistentVolume":
+		patch := []byte(fmt.Sprintf(`{"spec":{"persistentVolumeReclaimPolicy":%q}}`, corev1.PersistentVolumeReclaimDelete))
+		_, err := client.CoreV1().PersistentVolumes().Patch(ctx, o.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	case "VolumeSnapshotContent":
+		patch := []byte(`{"spec":{"deletionPolicy":"Delete"}}`)
+		_, err := dynamicClient.Resource(volumeSnapshotContentGVR).Patch(ctx, o.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err == nil {
+			err = dynamicClient.Resource(volumeSnapshotContentGVR).Delete(ctx, o.Name, metav1.DeleteOptions{})
+		}
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown kind %s", o.Kind)
+}
+
+// waitForLeakedStorageDeletion waits until the objects are gone or ctx
+// expires and returns the objects that still exist.
+func waitForLeakedStorageDeletion(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface, objects []leakedStorageObject) []leakedStorageObject {
+	remaining := objects
+	wait.PollImmediateUntil(5*time.Second, func() (bool, error) {
+		var stillThere []leakedStorageObject
+		for _, o := range remaining {
+			var err error
+			switch o.Kind {
+			case "PersistentVolume":
+				_, err = client.CoreV1().PersistentVolumes().Get(ctx, o.Name, metav1.GetOptions{})
+			case "VolumeSnapshotContent":
+				_, err = dynamicClient.Resource(volumeSnapshotContentGVR).Get(ctx, o.Name, metav1.GetOptions{})
+			}
+			if !apierrors.IsNotFound(err) {
+				stillThere = append(stillThere, o)
+			}
+		}
+		remaining = stillThere
+		return len(remaining) == 0, nil
+	}, ctx.Done())
+	return remaining
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFindLeakedPersistentVolumes(t *testing.T) {
+	namespace := func(name, runID string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{e2eRunLabel: runID}}}
+	}
+	pv := func(name, driver, claimNamespace string) *corev1.PersistentVolume {
+		pv := &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{Driver: driver},
+				},
+			},
+		}
+		if len(claimNamespace) > 0 {
+			pv.Spec.ClaimRef = &corev1.ObjectReference{Namespace: claimNamespace, Name: "claim"}
+		}
+		return pv
+	}
+
+	client := fake.NewSimpleClientset(
+		namespace("e2e-this-run", "run"),
+		namespace("e2e-other-run", "other"),
+		pv("pv-this-run", "csi.example.com", "e2e-this-run"),
+		pv("pv-other-run", "csi.example.com", "e2e-other-run"),
+		pv("pv-deleted-namespace", "csi.example.com", "e2e-deleted"),
+		pv("pv-deleted-namespace-of-others", "csi.example.com", "shared-deleted"),
+		pv("pv-other-driver", "csi.other.com", "e2e-this-run"),
+		pv("pv-unclaimed", "csi.example.com", ""),
+	)
+
+	owned := newRunNamespaceFilter(client, "run", sets.NewString("e2e-this-run", "e2e-deleted"))
+	leaked, err := findLeakedPersistentVolumes(context.Background(), client, sets.NewString("csi.example.com"), owned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := sets.NewString()
+	for _, o := range leaked {
+		names.Insert(o.Name)
+	}
+	if expected := sets.NewString("pv-this-run", "pv-deleted-namespace"); !names.Equal(expected) {
+		t.Errorf("expected leaked volumes %v, got %v", expected.List(), names.List())
+	}
+}
+
+func TestRunNamespaceRecorder(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	recorder := newRunNamespaceRecorder(client, "run")
+	for name, runID := range map[string]string{"e2e-this-run": "run", "e2e-other-run": "other"} {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{e2eRunLabel: runID}}}
+		if _, err := client.CoreV1().Namespaces().Create(context.Background(), ns, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.CoreV1().Namespaces().Create(context.Background(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "unlabelled"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		recorder.lock.Lock()
+		defer recorder.lock.Unlock()
+		return recorder.names.Has("e2e-this-run"), nil
+	})
+	if err != nil {
+		t.Fatal("the namespace of the run was not recorded")
+	}
+
+	// The namespace stays recorded once it is deleted.
+	if err := client.CoreV1().Namespaces().Delete(context.Background(), "e2e-this-run", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if recorded, expected := recorder.Stop(), sets.NewString("e2e-this-run"); !recorded.Equal(expected) {
+		t.Errorf("expected recorded namespaces %v, got %v", expected.List(), recorded.List())
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+)
+
+// openshift-tests does not register the upstream test flags, so the options
+// of the storage framework are passed from run to each run-test process in
+// the environment.
+const (
+	// storageTestPlanEnv is the file of --storage-test-plan.
+	storageTestPlanEnv = "TEST_STORAGE_PLAN"
+	// storageSkipRecordsEnv is the file that the tests append their skip
+	// records to when --storage-skip-report is set.
+	storageSkipRecordsEnv = "TEST_STORAGE_SKIP_RECORDS"
+)
+
+// setStorageTestOptionsFromEnv sets the options of the storage framework
+// that the run command passed to this test process.
+func setStorageTestOptionsFromEnv() {
+	if v := os.Getenv(storageTestPlanEnv); len(v) > 0 {
+		storageframework.TestPlanFile = v
+	}
+	if v := os.Getenv(storageSkipRecordsEnv); len(v) > 0 {
+		storageframework.SkipRecordsFile = v
+	}
+}
+
+// startStorageSkipRecords creates the file that the tests of the run append
+// their skip records to, if a skip report was requested.
+func startStorageSkipRecords(opt *runOptions) error {
+	if len(opt.StorageSkipReport) == 0 {
+		return nil
+	}
+	f, err := ioutil.TempFile("", "storage-skip-records-")
+	if err != nil {
+		return fmt.Errorf("unable to create the storage skip records: %v", err)
+	}
+	opt.storageSkipRecords = f.Name()
+	return f.Close()
+}
+
+// writeStorageSkipReport writes the skip report of the run from the records
+// of its tests.
+func writeStorageSkipReport(opt *runOptions) {
+	if len(opt.storageSkipRecords) == 0 {
+		return
+	}
+	defer os.Remove(opt.storageSkipRecords)
+	if err := storageframework.WriteSkipReport(opt.storageSkipRecords, opt.StorageSkipReport); err != nil {
+		fmt.Fprintf(opt.ErrOut, "error: Unable to write the storage skip report: %v\n", err)
+		return
+	}
+	fmt.Fprintf(opt.Out, "Wrote the report of the skipped storage tests to %s\n", opt.StorageSkipReport)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	storageframework "k8s.io/kubernetes/test/e2e/storage/framework"
+)
+
+// runTestEnv sets the storage variables of env, as run passes them to
+// run-test, and returns a function that restores the environment.
+func runTestEnv(t *testing.T, env []string) func() {
+	var restore []func()
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		name, value := parts[0], parts[1]
+		if !strings.HasPrefix(name, "TEST_STORAGE_") {
+			continue
+		}
+		if old, ok := os.LookupEnv(name); ok {
+			restore = append(restore, func() { os.Setenv(name, old) })
+		} else {
+			restore = append(restore, func() { os.Unsetenv(name) })
+		}
+		if err := os.Setenv(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for _, f := range restore {
+			f()
+		}
+	}
+}
+
+func TestStorageTestPlanReachesRunTest(t *testing.T) {
+	opt := NewRunOptions("")
+	flags := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	bindOptions(opt, flags)
+	if err := flags.Parse([]string{"--storage-test-plan=/tmp/plan.jsonl"}); err != nil {
+		t.Fatal(err)
+	}
+
+	defer runTestEnv(t, opt.AsEnv())()
+	defer func(old string) { storageframework.TestPlanFile = old }(storageframework.TestPlanFile)
+	setStorageTestOptionsFromEnv()
+	if storageframework.TestPlanFile != "/tmp/plan.jsonl" {
+		t.Errorf("expected the storage test plan /tmp/plan.jsonl in run-test, got %q", storageframework.TestPlanFile)
+	}
+}
+
+func TestStorageSkipReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage-skip-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	reportFile := filepath.Join(dir, "report.json")
+
+	opt := NewRunOptions("")
+	opt.Out, opt.ErrOut = &bytes.Buffer{}, &bytes.Buffer{}
+	flags := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	bindOptions(opt, flags)
+	if err := flags.Parse([]string{"--storage-skip-report=" + reportFile}); err != nil {
+		t.Fatal(err)
+	}
+	if err := startStorageSkipRecords(opt); err != nil {
+		t.Fatal(err)
+	}
+
+	defer runTestEnv(t, opt.AsEnv())()
+	defer func(old string) { storageframework.SkipRecordsFile = old }(storageframework.SkipRecordsFile)
+	setStorageTestOptionsFromEnv()
+	if storageframework.SkipRecordsFile != opt.storageSkipRecords {
+		t.Fatalf("expected the storage skip records %q in run-test, got %q", opt.storageSkipRecords, storageframework.SkipRecordsFile)
+	}
+
+	// The tests append their records as they skip.
+	records := []storageframework.SkipRecord{
+		{Test: "test-b", Driver: "csi.example.com", Suite: "provisioning", Pattern: "Block", Capability: storageframework.CapBlock, Reason: "no block"},
+		{Test: "test-a", Driver: "csi.example.com", Suite: "provisioning", Pattern: "Block", Capability: storageframework.CapBlock, Reason: "no block"},
+		{Test: "test-c", Driver: "csi.example.com", Suite: "ephemeral", Pattern: "Inline", Reason: "no inline volumes"},
+	}
+	var lines []byte
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(append(lines, data...), '\n')
+	}
+	if err := ioutil.WriteFile(storageframework.SkipRecordsFile, lines, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writeStorageSkipReport(opt)
+	if errOut := opt.ErrOut.(*bytes.Buffer).String(); len(errOut) > 0 {
+		t.Fatalf("unexpected error output: %s", errOut)
+	}
+	if _, err := os.Stat(opt.storageSkipRecords); !os.IsNotExist(err) {
+		t.Errorf("expected the skip records to be removed, got %v", err)
+	}
+	data, err := ioutil.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report storageframework.SkipReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	expectedSummary := []storageframework.SkipSummary{
+		{Driver: "csi.example.com", Suite: "ephemeral", Reason: "no inline volumes", Tests: 1},
+		{Driver: "csi.example.com", Suite: "provisioning", Capability: storageframework.CapBlock, Reason: "no block", Tests: 2},
+	}
+	if !reflect.DeepEqual(report.Summary, expectedSummary) {
+		t.Errorf("expected summary %#v, got %#v", expectedSummary, report.Summary)
+	}
+	var tests []string
+	for _, record := range report.Skipped {
+		tests = append(tests, record.Test)
+	}
+	if expected := []string{"test-a", "test-b", "test-c"}; !reflect.DeepEqual(tests, expected) {
+		t.Errorf("expected skipped tests %v, got %v", expected, tests)
+	}
+}
@@ -18,6 +18,9 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
 	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	"github.com/openshift/origin/test/extended/router/availability"
+	"github.com/openshift/origin/test/extended/router/httpprobe"
 )
 
 const (
@@ -168,6 +171,15 @@ var _ = g.Describe("[sig-cluster-lifecycle][Feature:Machines][Disruptive] Manage
 		}
 		numMachineWorkers := len(workerNodeToMachine)
 
+		// The routers of the default ingresscontroller run on the workers,
+		// so the canary route is disrupted until they are replaced.  The
+		// disruption is reported, not checked.
+		if canary, err := availability.CanaryRequest(cfg); err != nil {
+			e2e.Logf("Not monitoring the ingress canary route: %v", err)
+		} else {
+			defer availability.StartRouteAvailabilityMonitor("worker-machines-recovery", httpprobe.NewDirect(), canary)()
+		}
+
 		g.By("deleting all worker nodes")
 		for _, machine := range workerNodeToMachine {
 			machineName := machine.Get("metadata.name").String()
@@ -0,0 +1,361 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	t "github.com/onsi/ginkgo/extensions/table"
+	o "github.com/onsi/gomega"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/routerstats"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+// annotationCheck is what a route annotation test case verifies the
+// behavior of its route with.
+type annotationCheck struct {
+	oc          *exutil.CLI
+	ns          string
+	execPodName string
+	execPodIP   string
+	prober      *httpprobe.Prober
+	stats       *routerstats.Client
+	routerIP    string
+	route       string
+	host        string
+}
+
+// url returns the URL of path on the router.
+func (c annotationCheck) url(path string) string {
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(c.routerIP, "80"), path)
+}
+
+// request returns a request for path on the route.
+func (c annotationCheck) request(path string) httpprobe.Request {
+	return httpprobe.Request{Host: c.host, Address: c.routerIP, Path: path, Timeout: 15 * time.Second}
+}
+
+// annotate sets annotations on the route and waits for the router to
+// reload with them.
+func (c annotationCheck) annotate(annotations map[string]string) {
+	reloads, err := routerReloads(c.stats)
+	o.Expect(err).NotTo(o.HaveOccurred())
+
+	client := routeclientset.NewForConfigOrDie(c.oc.AdminConfig()).RouteV1().Routes(c.ns)
+	route, err := client.Get(context.Background(), c.route, metav1.GetOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+	if route.Annotations == nil {
+		route.Annotations = map[string]string{}
+	}
+	for name, value := range annotations {
+		route.Annotations[name] = value
+	}
+	_, err = client.Update(context.Background(), route, metav1.UpdateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+
+	err = wait.PollImmediate(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+		current, err := routerReloads(c.stats)
+		if err != nil {
+			e2e.Logf("unable to read the router reloads: %v", err)
+			return false, nil
+		}
+		return current > reloads, nil
+	})
+	o.Expect(err).NotTo(o.HaveOccurred(), "the router did not reload with the annotations %v", annotations)
+}
+
+// hostnames makes times requests for the hostname of the endpoint that
+// serves them, sending cookie if it is not nil, and returns the hostnames and
+// the cookies that the router set on the responses.
+func (c annotationCheck) hostnames(times int, cookie *http.Cookie) (sets.String, []*http.Cookie) {
+	req := c.request("/hostname")
+	if cookie != nil {
+		req.Header = http.Header{"Cookie": []string{cookie.String()}}
+	}
+	hostnames := sets.NewString()
+	var cookies []*http.Cookie
+	for i := 0; i < times; i++ {
+		resp, err := c.prober.Do(req)
+		o.Expect(err).NotTo(o.HaveOccurred())
+		o.Expect(resp.StatusCode).To(o.Equal(http.StatusOK))
+		hostnames.Insert(string(resp.Body))
+		cookies = append(cookies, (&http.Response{Header: resp.Header}).Cookies()...)
+	}
+	return hostnames, cookies
+}
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc          *exutil.CLI
+		ns          string
+		routerImage string
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("router-", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-annotations")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		// Each case starts with a route without annotations that
+		// serves requests, sets its annotations, and verifies the
+		// behavior that they configure once the router reloaded.
+		t.DescribeTable("should apply the haproxy.router.openshift.io annotations of a route", func(annotations map[string]string, backends int, verify func(annotationCheck)) {
+			c, cleanup := deployAnnotationsRoute(oc, routerImage, backends)
+			defer cleanup()
+
+			g.By(fmt.Sprintf("annotating the route with %v", annotations))
+			c.annotate(annotations)
+
+			verify(c)
+		},
+			t.Entry("timeout", map[string]string{
+				"haproxy.router.openshift.io/timeout": "2s",
+			}, 1, verifyTimeoutAnnotation),
+			t.Entry("rate-limit-connections", map[string]string{
+				"haproxy.router.openshift.io/rate-limit-connections":           "true",
+				"haproxy.router.openshift.io/rate-limit-connections.rate-http": "5",
+			}, 1, verifyRateLimitAnnotation),
+			t.Entry("ip_whitelist", map[string]string{
+				"haproxy.router.openshift.io/ip_whitelist": "192.0.2.1",
+			}, 1, verifyWhitelistAnnotation),
+			t.Entry("balance roundrobin", map[string]string{
+				"haproxy.router.openshift.io/balance": "roundrobin",
+			}, 2, verifyBalanceAnnotation(2)),
+			t.Entry("balance source", map[string]string{
+				"haproxy.router.openshift.io/balance": "source",
+			}, 2, verifyBalanceAnnotation(1)),
+		)
+
+		g.It("should keep a client on one endpoint with the route cookie until cookies are disabled", func() {
+			c, cleanup := deployAnnotationsRoute(oc, routerImage, 3)
+			defer cleanup()
+
+			g.By("checking that requests without a cookie are spread across the endpoints")
+			hostnames, cookies := c.hostnames(10, nil)
+			o.Expect(hostnames.Len()).To(o.BeNumerically(">", 1), "requests without a cookie should reach several endpoints")
+			o.Expect(cookies).NotTo(o.BeEmpty(), "the router should set a cookie on the responses")
+			cookie := cookies[0]
+
+			g.By(fmt.Sprintf("checking that requests with the cookie %s stick to one endpoint", cookie.Name))
+			hostnames, _ = c.hostnames(10, cookie)
+			o.Expect(hostnames.List()).To(o.HaveLen(1), "requests with the cookie should reach a single endpoint")
+
+			g.By("disabling cookies for the route")
+			c.annotate(map[string]string{"haproxy.router.openshift.io/disable_cookies": "true"})
+
+			g.By("checking that the router ignores the cookie and sets no cookies")
+			hostnames, cookies = c.hostnames(10, cookie)
+			o.Expect(cookies).To(o.BeEmpty(), "the router should not set cookies")
+			o.Expect(hostnames.Len()).To(o.BeNumerically(">", 1), "requests with the former cookie should reach several endpoints")
+		})
+	})
+})
+
+// deployAnnotationsRoute creates a netexec backend with the given number of
+// endpoints, a route to it without annotations and a router for the route in
+// the test namespace, and waits for the route to respond.  The returned
+// cleanup function deletes the exec pod that the check makes its requests
+// from.
+func deployAnnotationsRoute(oc *exutil.CLI, routerImage string, backends int) (annotationCheck, func()) {
+	ns := oc.Namespace()
+
+	g.By(fmt.Sprintf("creating a backend with %d endpoints", backends))
+	createNetexecBackend(oc.KubeClient(), ns, "annotations")
+	for i := 1; i < backends; i++ {
+		createNetexecPod(oc.KubeClient(), ns, fmt.Sprintf("annotations-%d", i), map[string]string{"app": "annotations"})
+	}
+
+	host := "annotations.example.com"
+	_, err := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns).Create(context.Background(), &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "annotations",
+			Labels: map[string]string{"select": "annotations"},
+		},
+		Spec: routev1.RouteSpec{
+			Host: host,
+			To:   routev1.RouteTargetReference{Name: "annotations"},
+			Port: &routev1.RoutePort{
+				TargetPort: intstr.FromInt(8080),
+			},
+		},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+
+	g.By("deploying a router")
+	rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter("router-annotations", routerImage, "select=annotations"), metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+	o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+	pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=router-annotations"})
+	o.Expect(err).NotTo(o.HaveOccurred())
+	o.Expect(pods.Items).To(o.HaveLen(1))
+	routerIP := pods.Items[0].Status.PodIP
+
+	execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+	cleanup := func() {
+		oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+	}
+	execPod, err = oc.AdminKubeClient().CoreV1().Pods(ns).Get(context.Background(), execPod.Name, metav1.GetOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+	c := annotationCheck{
+		oc:          oc,
+		ns:          ns,
+		execPodName: execPod.Name,
+		execPodIP:   execPod.Status.PodIP,
+		prober:      httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name),
+		stats:       routerstats.ForTestRouter(ns, execPod.Name, routerIP),
+		routerIP:    routerIP,
+		route:       "annotations",
+		host:        host,
+	}
+
+	g.By("waiting for the route to respond")
+	_, err = c.prober.WaitForStatus(c.request("/echo?msg=ok"), http.StatusOK, changeTimeoutSeconds*time.Second)
+	o.Expect(err).NotTo(o.HaveOccurred())
+	return c, cleanup
+}
+
+// verifyTimeoutAnnotation expects a 2s server timeout: a response that is
+// delayed by 4s times out with 504, one that is delayed by 1s does not.
+func verifyTimeoutAnnotation(c annotationCheck) {
+	g.By("checking that a slow response times out with 504")
+	resp, err := c.prober.Do(c.request("/shell?cmd=sleep%204"))
+	o.Expect(err).NotTo(o.HaveOccurred())
+	o.Expect(resp.StatusCode).To(o.Equal(http.StatusGatewayTimeout))
+
+	g.By("checking that a response within the timeout succeeds")
+	resp, err = c.prober.Do(c.request("/shell?cmd=sleep%201"))
+	o.Expect(err).NotTo(o.HaveOccurred())
+	o.Expect(resp.StatusCode).To(o.Equal(http.StatusOK))
+}
+
+// verifyRateLimitAnnotation expects a limit of 5 HTTP requests per source
+// address in the router's 10s window: a burst of 20 requests gets the first
+// ones through and the rest rejected.
+func verifyRateLimitAnnotation(c annotationCheck) {
+	g.By("sending a burst of requests past the rate limit")
+	codes, _, err := routeResponsesExec(c.ns, c.execPodName, c.url("/echo?msg=ok"), c.host, 20)
+	o.Expect(err).NotTo(o.HaveOccurred())
+	e2e.Logf("status codes of the burst: %v", codes)
+	o.Expect(codes[0]).To(o.Equal("200"), "the first request of the burst should be within the rate limit")
+	rejected := 0
+	for _, code := range codes {
+		switch code {
+		case "200":
+		case "000":
+			rejected++
+		default:
+			o.Expect(code).To(o.Equal("200"), "requests are either served or rejected")
+		}
+	}
+	o.Expect(rejected).To(o.BeNumerically(">=", 10), "the router should reject the requests past the rate limit")
+}
+
+// verifyWhitelistAnnotation expects connections from the exec pod to be
+// rejected while it is not whitelisted, and to be served once it is.
+func verifyWhitelistAnnotation(c annotationCheck) {
+	g.By("checking that a client that is not whitelisted is rejected")
+	resp, err := c.prober.Do(c.request("/echo?msg=ok"))
+	if err == nil {
+		o.Expect(resp.StatusCode).To(o.Equal(http.StatusForbidden), "a client that is not whitelisted should be denied")
+	}
+
+	g.By("whitelisting the client")
+	c.annotate(map[string]string{"haproxy.router.openshift.io/ip_whitelist": "192.0.2.1 " + c.execPodIP})
+	resp, err = c.prober.Do(c.request("/echo?msg=ok"))
+	o.Expect(err).NotTo(o.HaveOccurred())
+	o.Expect(resp.StatusCode).To(o.Equal(http.StatusOK))
+}
+
+// verifyBalanceAnnotation returns a check that expects requests from a
+// single client to reach the given number of the backend's endpoints.
+func verifyBalanceAnnotation(endpoints int) func(annotationCheck) {
+	return func(c annotationCheck) {
+		g.By(fmt.Sprintf("checking that the requests of a client reach %d endpoints", endpoints))
+		codes, bodies, err := routeResponsesExec(c.ns, c.execPodName, c.url("/hostname"), c.host, 20)
+		o.Expect(err).NotTo(o.HaveOccurred())
+		hostnames := sets.NewString()
+		for i, code := range codes {
+			o.Expect(code).To(o.Equal("200"))
+			hostnames.Insert(bodies[i])
+		}
+		o.Expect(hostnames.List()).To(o.HaveLen(endpoints))
+	}
+}
+
+// routeResponsesExec sends times requests for url with the given Host header
+// in a row from the exec pod and returns the status code and body of each.
+// A request that fails without a response has the status code 000.
+func routeResponsesExec(ns, execPodName, url, host string, times int) ([]string, []string, error) {
+	cmd := fmt.Sprintf(`
+		for i in $(seq 1 %d); do
+			out=$( curl -s -m 5 -w ' %%{http_code}' --header 'Host: %s' %q ) || out=" 000"
+			echo "$out"
+		done
+		`, times, host, url)
+	output, err := e2e.RunHostCmd(ns, execPodName, cmd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("host command failed: %v\n%s", err, output)
+	}
+	var codes, bodies []string
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		i := strings.LastIndex(line, " ")
+		codes = append(codes, line[i+1:])
+		bodies = append(bodies, line[:i])
+	}
+	if len(codes) != times {
+		return nil, nil, fmt.Errorf("expected %d responses, got:\n%s", times, output)
+	}
+	return codes, bodies, nil
+}
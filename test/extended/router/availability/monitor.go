@@ -0,0 +1,133 @@
+// Package availability monitors the availability of a route while a test
+// disrupts the routers that serve it.  A monitor requests the route every
+// requestInterval through an httpprobe.Prober, records the windows in which
+// the requests failed, and reports them when it is stopped:
+//
+//	stop := availability.StartRouteAvailabilityMonitor("router-restart", prober, req)
+//	defer stop()
+//	...
+//	report := stop()
+//	o.Expect(report.FailureRate()).To(o.BeNumerically("<=", 0.01), "%s", report)
+//
+// The report is also written to $ARTIFACT_DIR, when it is set, so that the
+// disruption of every monitored test can be collected after a run.
+package availability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+)
+
+const (
+	// CanaryNamespace and CanaryRoute name the route that the ingress
+	// operator creates to check that the default ingresscontroller serves
+	// routes.
+	CanaryNamespace = "openshift-ingress-canary"
+	CanaryRoute     = "canary"
+
+	// reportDir is the directory of $ARTIFACT_DIR that reports are
+	// written to.
+	reportDir = "router-availability"
+
+	// requestInterval paces the requests of a monitor, so that it does not
+	// load the router it measures.  A request that takes longer delays the
+	// next one.
+	requestInterval = 200 * time.Millisecond
+)
+
+// StartRouteAvailabilityMonitor starts requesting req with prober every
+// requestInterval until the returned function is called.  A request fails if it errors or if the
+// router does not respond with 200.  The returned function stops the
+// monitor, logs and writes its report, and returns it; it can be called more
+// than once, for example deferred and again to check the report, and always
+// returns the same report.  name identifies the report, it should be unique
+// to the test.
+func StartRouteAvailabilityMonitor(name string, prober *httpprobe.Prober, req httpprobe.Request) func() *Report {
+	report := &Report{Name: name, URL: req.URL(), Start: time.Now()}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(requestInterval)
+		defer ticker.Stop()
+		for {
+			start := time.Now()
+			resp, err := prober.Do(req)
+			if err == nil && resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+			report.record(start, err)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() *Report {
+		once.Do(func() {
+			close(stop)
+			<-done
+			report.finish(time.Now())
+			e2e.Logf("%s", report)
+			if err := report.write(); err != nil {
+				e2e.Logf("failed to write the availability report of %s: %v", name, err)
+			}
+		})
+		return report
+	}
+}
+
+// CanaryRequest returns a request for the canary route of the default
+// ingresscontroller.  The request has no address, so it is resolved and
+// load balanced the way that clients of the cluster's routes are.
+func CanaryRequest(config *rest.Config) (httpprobe.Request, error) {
+	client, err := routeclientset.NewForConfig(config)
+	if err != nil {
+		return httpprobe.Request{}, err
+	}
+	route, err := client.RouteV1().Routes(CanaryNamespace).Get(context.Background(), CanaryRoute, metav1.GetOptions{})
+	if err != nil {
+		return httpprobe.Request{}, fmt.Errorf("failed to get the canary route: %v", err)
+	}
+	req := httpprobe.Request{Host: route.Spec.Host, Timeout: 10 * time.Second}
+	if route.Spec.TLS != nil {
+		req.Scheme = "https"
+	}
+	return req, nil
+}
+
+// write writes r as JSON to $ARTIFACT_DIR, if it is set.
+func (r *Report) write() error {
+	dir := os.Getenv("ARTIFACT_DIR")
+	if len(dir) == 0 {
+		return nil
+	}
+	dir = filepath.Join(dir, reportDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", r.Name, r.Start.UTC().Format("20060102T150405Z")))
+	return ioutil.WriteFile(path, data, 0644)
+}
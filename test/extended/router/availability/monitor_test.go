@@ -0,0 +1,58 @@
+package availability
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+)
+
+func TestMonitorPacesRequests(t *testing.T) {
+	var served int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&served, 1)
+	}))
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	dir, err := ioutil.TempDir("", "availability")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("ARTIFACT_DIR", os.Getenv("ARTIFACT_DIR"))
+	os.Setenv("ARTIFACT_DIR", dir)
+
+	stop := StartRouteAvailabilityMonitor("paced", httpprobe.NewDirect(), httpprobe.Request{
+		Host:    "route.example.test",
+		Address: addr.IP.String(),
+		Port:    addr.Port,
+	})
+	time.Sleep(time.Second)
+	report := stop()
+
+	// A request every 200ms for a second, allowing for slow requests.
+	if report.Requests < 2 || report.Requests > 7 {
+		t.Errorf("expected about 5 requests in a second, got %d", report.Requests)
+	}
+	if report.Failures != 0 {
+		t.Errorf("expected no failures, got %s", report)
+	}
+	if int(atomic.LoadInt32(&served)) != report.Requests {
+		t.Errorf("expected the server to see %d requests, got %d", report.Requests, served)
+	}
+	reports, err := filepath.Glob(filepath.Join(dir, reportDir, "paced-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Errorf("expected the report to be written to the artifacts, got %v", reports)
+	}
+}
@@ -0,0 +1,86 @@
+package availability
+
+import (
+	"fmt"
+	"time"
+)
+
+// Report is the availability of a route while it was monitored.
+type Report struct {
+	Name  string    `json:"name"`
+	URL   string    `json:"url"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	Requests int `json:"requests"`
+	Failures int `json:"failures"`
+	// Disruptions are the windows of consecutive failed requests.
+	Disruptions []Disruption `json:"disruptions,omitempty"`
+}
+
+// Disruption is a window in which every request failed.  It starts when the
+// first failed request was sent, and ends when the next successful request
+// was sent, or when the monitor stopped.
+type Disruption struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Failures int       `json:"failures"`
+	// Error is the error of the first failed request.
+	Error string `json:"error"`
+}
+
+// Duration returns how long the disruption lasted.
+func (d Disruption) Duration() time.Duration {
+	return d.End.Sub(d.Start)
+}
+
+// FailureRate returns the fraction of the requests that failed, or zero if
+// there were none.
+func (r *Report) FailureRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Failures) / float64(r.Requests)
+}
+
+// Disrupted returns how long the route was disrupted in total.
+func (r *Report) Disrupted() time.Duration {
+	var total time.Duration
+	for _, d := range r.Disruptions {
+		total += d.Duration()
+	}
+	return total
+}
+
+func (r *Report) String() string {
+	s := fmt.Sprintf("%s: %d of %d requests to %s failed over %s, disrupted for %s",
+		r.Name, r.Failures, r.Requests, r.URL, r.End.Sub(r.Start).Round(time.Millisecond), r.Disrupted().Round(time.Millisecond))
+	for _, d := range r.Disruptions {
+		s += fmt.Sprintf("\n  %s for %s, %d failed requests: %s", d.Start.UTC().Format(time.RFC3339), d.Duration().Round(time.Millisecond), d.Failures, d.Error)
+	}
+	return s
+}
+
+// record records the result of a request that was sent at start.
+func (r *Report) record(start time.Time, err error) {
+	r.Requests++
+	open := len(r.Disruptions) > 0 && r.Disruptions[len(r.Disruptions)-1].End.IsZero()
+	switch {
+	case err != nil && open:
+		r.Failures++
+		r.Disruptions[len(r.Disruptions)-1].Failures++
+	case err != nil:
+		r.Failures++
+		r.Disruptions = append(r.Disruptions, Disruption{Start: start, Failures: 1, Error: err.Error()})
+	case open:
+		r.Disruptions[len(r.Disruptions)-1].End = start
+	}
+}
+
+// finish ends the report, and the disruption that is still open, at end.
+func (r *Report) finish(end time.Time) {
+	r.End = end
+	if len(r.Disruptions) > 0 && r.Disruptions[len(r.Disruptions)-1].End.IsZero() {
+		r.Disruptions[len(r.Disruptions)-1].End = end
+	}
+}
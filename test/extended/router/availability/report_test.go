@@ -0,0 +1,50 @@
+package availability
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReportRecord(t *testing.T) {
+	t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return t0.Add(time.Duration(seconds) * time.Second) }
+	failed := errors.New("connection refused")
+
+	r := &Report{Name: "test", Start: t0}
+	r.record(at(0), nil)
+	r.record(at(1), failed)
+	r.record(at(2), errors.New("status 503"))
+	r.record(at(4), nil)
+	r.record(at(5), nil)
+	r.record(at(6), failed)
+	r.finish(at(7))
+
+	if r.Requests != 6 || r.Failures != 3 {
+		t.Errorf("expected 3 of 6 requests to fail, got %d of %d", r.Failures, r.Requests)
+	}
+	if r.FailureRate() != 0.5 {
+		t.Errorf("expected a failure rate of 0.5, got %v", r.FailureRate())
+	}
+	if len(r.Disruptions) != 2 {
+		t.Fatalf("expected 2 disruptions, got %+v", r.Disruptions)
+	}
+	first := r.Disruptions[0]
+	if !first.Start.Equal(at(1)) || !first.End.Equal(at(4)) || first.Failures != 2 || first.Error != failed.Error() {
+		t.Errorf("unexpected first disruption %+v", first)
+	}
+	if last := r.Disruptions[1]; !last.End.Equal(at(7)) || last.Failures != 1 {
+		t.Errorf("expected the last disruption to end with the report, got %+v", last)
+	}
+	if r.Disrupted() != 4*time.Second {
+		t.Errorf("expected 4s of disruption, got %s", r.Disrupted())
+	}
+}
+
+func TestReportWithoutRequests(t *testing.T) {
+	r := &Report{Name: "test", Start: time.Now()}
+	r.finish(time.Now())
+	if r.FailureRate() != 0 || r.Disrupted() != 0 || len(r.Disruptions) != 0 {
+		t.Errorf("expected an empty report, got %s", r)
+	}
+}
@@ -48,6 +48,25 @@ func MarshalCertToPEMString(derBytes []byte) (string, error) {
 // hosts. Certificate is valid from notBefore and expires after
 // notAfter.
 func GenerateKeyPair(notBefore, notAfter time.Time, hosts ...string) ([]byte, []byte, *ecdsa.PrivateKey, error) {
+	subject := pkix.Name{
+		Organization: []string{"Red Hat"},
+		CommonName:   "test_cert",
+	}
+	return generateKeyPair(notBefore, notAfter, subject, x509.ExtKeyUsageServerAuth, hosts...)
+}
+
+// GenerateClientKeyPair creates root CA, client certificate and key
+// for commonName, as used for mutual TLS. Certificate is valid from
+// notBefore and expires after notAfter.
+func GenerateClientKeyPair(notBefore, notAfter time.Time, commonName string) ([]byte, []byte, *ecdsa.PrivateKey, error) {
+	subject := pkix.Name{
+		Organization: []string{"Red Hat"},
+		CommonName:   commonName,
+	}
+	return generateKeyPair(notBefore, notAfter, subject, x509.ExtKeyUsageClientAuth)
+}
+
+func generateKeyPair(notBefore, notAfter time.Time, subject pkix.Name, usage x509.ExtKeyUsage, hosts ...string) ([]byte, []byte, *ecdsa.PrivateKey, error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
@@ -89,15 +108,12 @@ func GenerateKeyPair(notBefore, notAfter time.Time, hosts ...string) ([]byte, []
 	}
 
 	leafCertTemplate := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"Red Hat"},
-			CommonName:   "test_cert",
-		},
+		SerialNumber:          serialNumber,
+		Subject:               subject,
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
 		BasicConstraintsValid: true,
 		IsCA:                  false,
 	}
@@ -0,0 +1,238 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientset "k8s.io/client-go/kubernetes"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	"k8s.io/kubernetes/test/utils/image"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+// contentTypeBody is the body that the content type backend serves for every
+// content type.  It is long and repetitive, so that compressing it is always
+// worthwhile.
+var contentTypeBody = strings.Repeat("the quick brown fox jumps over the lazy dog ", 100)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc = exutil.NewCLI("router-compression")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should gzip the responses of the mime types of the httpCompression policy of the ingresscontroller", func() {
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			g.By("creating a backend that serves several content types and a route to it")
+			createContentTypeBackend(oc.KubeClient(), ns, "content-types")
+			host := "content-types." + shardFQDN
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			_, err = routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "content-types",
+				},
+				Spec: routev1.RouteSpec{
+					Host: host,
+					To:   routev1.RouteTargetReference{Name: "content-types"},
+					Port: &routev1.RoutePort{
+						TargetPort: intstr.FromInt(8080),
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating a router shard that compresses text/plain and application/json")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.HTTPCompression = operatorv1.HTTPCompressionPolicy{
+					MimeTypes: []operatorv1.CompressionMIMEType{"text/plain", "application/json"},
+				}
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			_, err = waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, "content-types", shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerIP := routerPods[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+
+			g.By("waiting for the route to respond")
+			_, err = prober.WaitForStatus(httpprobe.Request{Host: host, Address: routerIP, Path: "/text", Timeout: 15 * time.Second}, http.StatusOK, changeTimeoutSeconds*time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			for _, tc := range []struct {
+				path           string
+				acceptEncoding string
+				gzipped        bool
+			}{
+				{path: "/text", acceptEncoding: "gzip", gzipped: true},
+				{path: "/json", acceptEncoding: "gzip", gzipped: true},
+				{path: "/text", acceptEncoding: "br, gzip;q=0.5", gzipped: true},
+				{path: "/csv", acceptEncoding: "gzip", gzipped: false},
+				{path: "/text", acceptEncoding: "", gzipped: false},
+				{path: "/text", acceptEncoding: "identity", gzipped: false},
+				{path: "/text", acceptEncoding: "gzip;q=0", gzipped: false},
+			} {
+				g.By(fmt.Sprintf("requesting %s with Accept-Encoding %q", tc.path, tc.acceptEncoding))
+				req := httpprobe.Request{Host: host, Address: routerIP, Path: tc.path, Timeout: 15 * time.Second}
+				if len(tc.acceptEncoding) > 0 {
+					req.Header = http.Header{"Accept-Encoding": []string{tc.acceptEncoding}}
+				}
+				resp, err := prober.Do(req)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(resp.StatusCode).To(o.Equal(http.StatusOK))
+
+				body := resp.Body
+				if !tc.gzipped {
+					o.Expect(resp.Header.Get("Content-Encoding")).To(o.BeEmpty(), "%s with Accept-Encoding %q", tc.path, tc.acceptEncoding)
+				} else {
+					o.Expect(resp.Header.Get("Content-Encoding")).To(o.Equal("gzip"), "%s with Accept-Encoding %q", tc.path, tc.acceptEncoding)
+					o.Expect(len(resp.Body)).To(o.BeNumerically("<", len(contentTypeBody)))
+					reader, err := gzip.NewReader(bytes.NewReader(resp.Body))
+					o.Expect(err).NotTo(o.HaveOccurred())
+					body, err = ioutil.ReadAll(reader)
+					o.Expect(err).NotTo(o.HaveOccurred())
+				}
+				o.Expect(string(body)).To(o.Equal(contentTypeBody), "%s with Accept-Encoding %q", tc.path, tc.acceptEncoding)
+			}
+		})
+	})
+})
+
+// createContentTypeBackend creates an nginx pod that serves contentTypeBody
+// uncompressed as text/plain on /text, as application/json on /json and as
+// text/csv on /csv, and a service of the same name in namespace ns that
+// exposes it on port 8080.
+func createContentTypeBackend(client clientset.Interface, ns, name string) {
+	var locations []string
+	for _, location := range [][2]string{
+		{"/text", "text/plain"},
+		{"/json", "application/json"},
+		{"/csv", "text/csv"},
+	} {
+		locations = append(locations, fmt.Sprintf("    location = %s {\n      default_type %s;\n      return 200 %q;\n    }", location[0], location[1], contentTypeBody))
+	}
+	config := fmt.Sprintf("daemon off;\nevents { }\nhttp {\n  gzip off;\n  server {\n    listen 8080;\n%s\n  }\n}\n", strings.Join(locations, "\n"))
+	_, err := client.CoreV1().ConfigMaps(ns).Create(context.Background(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Data: map[string]string{"nginx.conf": config},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+
+	podLabels := map[string]string{"app": name}
+	_, err = client.CoreV1().Pods(ns).Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: podLabels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "serve",
+					Image:   image.GetE2EImage(image.Nginx),
+					Command: []string{"/usr/sbin/nginx", "-c", "/etc/nginx/nginx.conf"},
+					Ports:   []corev1.ContainerPort{{ContainerPort: 8080}},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "conf", MountPath: "/etc/nginx"},
+						{Name: "tmp", MountPath: "/var/cache/nginx"},
+						{Name: "run", MountPath: "/var/run"},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "conf", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}}},
+				{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				{Name: "run", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+	e2e.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(client, name, ns))
+
+	_, err = client.CoreV1().Services(ns).Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: podLabels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       8080,
+					TargetPort: intstr.FromInt(8080),
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+}
@@ -4,18 +4,29 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"strings"
+	"net/http"
 	"time"
 
 	g "github.com/onsi/ginkgo"
+	t "github.com/onsi/ginkgo/extensions/table"
 	o "github.com/onsi/gomega"
 
+	corev1 "k8s.io/api/core/v1"
+	kapierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2edeployment "k8s.io/kubernetes/test/e2e/framework/deployment"
+	testutils "k8s.io/kubernetes/test/utils"
 
+	routev1 "github.com/openshift/api/route/v1"
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 
+	"github.com/openshift/origin/test/extended/router/haproxyconfig"
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/routerstats"
 	exutil "github.com/openshift/origin/test/extended/util"
 )
 
@@ -44,9 +55,6 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 	oc = exutil.NewCLI("router-config-manager")
 
 	g.BeforeEach(func() {
-		// the test has been skipped since July 2018 because it was flaking.
-		// TODO: Fix the test and re-enable it in https://issues.redhat.com/browse/NE-906.
-		g.Skip("HAProxy dynamic config manager tests skipped in 4.x")
 		ns = oc.Namespace()
 
 		routerImage, err := exutil.FindRouterImage(oc)
@@ -58,9 +66,6 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 
 	g.Describe("The HAProxy router", func() {
 		g.It("should serve the correct routes when running with the haproxy config manager", func() {
-			// the test has been skipped since July 2018 because it was flaking.
-			// TODO: Fix the test and re-enable it in https://issues.redhat.com/browse/NE-906.
-			g.Skip("HAProxy dynamic config manager tests skipped in 4.x")
 			ns := oc.KubeFramework().Namespace.Name
 			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
 			defer func() {
@@ -69,111 +74,469 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 
 			g.By(fmt.Sprintf("creating a router with haproxy config manager from a config file %q", configPath))
 
-			var routerIP string
-			err := wait.Poll(time.Second, timeoutSeconds*time.Second, func() (bool, error) {
-				pod, err := oc.KubeFramework().ClientSet.CoreV1().Pods(oc.KubeFramework().Namespace.Name).Get(context.Background(), "router-haproxy-cfgmgr", metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-				if len(pod.Status.PodIP) == 0 {
-					return false, nil
-				}
-				routerIP = pod.Status.PodIP
-				return true, nil
-			})
+			routerIP, err := waitForRouterIP(oc, "router-haproxy-cfgmgr")
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			g.By("waiting for the healthz endpoint to respond")
-			healthzURI := fmt.Sprintf("http://%s/healthz", net.JoinHostPort(routerIP, "1936"))
-			err = waitForRouterOKResponseExec(ns, execPod.Name, healthzURI, routerIP, timeoutSeconds)
+			statsClient := routerstats.ForTestRouter(ns, execPod.Name, routerIP)
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			err = statsClient.WaitForHealthz(timeoutSeconds * time.Second)
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			g.By("waiting for the valid routes to respond")
-			err = waitForRouteToRespond(ns, execPod.Name, "http", "insecure.hapcm.test", "/", routerIP, 0)
+			err = waitForRouteReady(prober, "http", "insecure.hapcm.test", routerIP)
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			for _, host := range []string{"edge.allow.hapcm.test", "reencrypt.hapcm.test", "passthrough.hapcm.test"} {
-				err = waitForRouteToRespond(ns, execPod.Name, "https", host, "/", routerIP, 0)
+				err = waitForRouteReady(prober, "https", host, routerIP)
 				o.Expect(err).NotTo(o.HaveOccurred())
 			}
+		})
+
+		// Each route type runs as its own case so that the cases can run in
+		// parallel, each against its own router.
+		t.DescribeTable("should expose routes added and removed while running with the haproxy config manager", func(routeType string) {
+			ns := oc.KubeFramework().Namespace.Name
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			routerIP, err := waitForRouterIP(oc, "router-haproxy-cfgmgr")
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("waiting for the healthz endpoint to respond")
+			statsClient := routerstats.ForTestRouter(ns, execPod.Name, routerIP)
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			err = statsClient.WaitForHealthz(timeoutSeconds * time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
 
-			g.By("mini stress test by adding (and removing) different routes and checking that they are exposed")
+			g.By(fmt.Sprintf("adding and removing %s routes and checking that they are exposed", routeType))
 			for i := 0; i < 16; i++ {
-				name := fmt.Sprintf("hapcm-stress-insecure-%d", i)
-				hostName := fmt.Sprintf("stress.insecure-%d.hapcm.test", i)
-				err := oc.AsAdmin().Run("expose").Args("service", "insecure-service", "--name", name, "--hostname", hostName, "--labels", "select=haproxy-cfgmgr").Execute()
-				o.Expect(err).NotTo(o.HaveOccurred())
+				name := fmt.Sprintf("hapcm-stress-%s-%d", routeType, i)
+				hostName := fmt.Sprintf("stress.%s-%d.hapcm.test", routeType, i)
+				proto := createConfigManagerRoute(oc, routeType, name, hostName)
 
-				err = waitForRouteToRespond(ns, execPod.Name, "http", hostName, "/", routerIP, 0)
+				err = waitForRouteReady(prober, proto, hostName, routerIP)
 				o.Expect(err).NotTo(o.HaveOccurred())
 
 				err = oc.AsAdmin().Run("delete").Args("route", name).Execute()
 				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+		},
+			t.Entry("insecure", "insecure"),
+			t.Entry("edge", "edge"),
+			t.Entry("reencrypt", "reencrypt"),
+			t.Entry("passthrough", "passthrough"),
+		)
 
-				routeTypes := []string{"edge", "reencrypt", "passthrough"}
-				for _, t := range routeTypes {
-					name := fmt.Sprintf("hapcm-stress-%s-%d", t, i)
-					hostName := fmt.Sprintf("stress.%s-%d.hapcm.test", t, i)
-					serviceName := "secure-service"
-					if t == "edge" {
-						serviceName = "insecure-service"
-					}
+		// The router pre-allocates a pool of backends for each
+		// blueprint route, and a route that matches a blueprint takes
+		// a free backend of its pool without a reload.
+		t.DescribeTable("should serve a route added to a blueprint pool without a reload", func(routeType string) {
+			ns := oc.KubeFramework().Namespace.Name
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			routerIP, err := waitForRouterIP(oc, "router-haproxy-cfgmgr")
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("waiting for the healthz endpoint to respond")
+			statsClient := routerstats.ForTestRouter(ns, execPod.Name, routerIP)
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			err = statsClient.WaitForHealthz(timeoutSeconds * time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("waiting for the router to stop reloading after the initial sync")
+			err = waitForRouteReady(prober, "http", "insecure.hapcm.test", routerIP)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			reloads, err := waitForStableReloads(statsClient)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			for i := 0; i < 3; i++ {
+				name := fmt.Sprintf("hapcm-pool-%s-%d", routeType, i)
+				hostName := fmt.Sprintf("pool.%s-%d.hapcm.test", routeType, i)
+				g.By(fmt.Sprintf("adding %s route %s", routeType, name))
+				proto := createConfigManagerRoute(oc, routeType, name, hostName)
+
+				err = waitForRouteReady(prober, proto, hostName, routerIP)
+				o.Expect(err).NotTo(o.HaveOccurred())
+
+				g.By("checking that the router did not reload")
+				o.Expect(routerReloads(statsClient)).To(o.Equal(reloads), "the router reloaded to serve route %s", name)
+			}
+		},
+			t.Entry("insecure", "insecure"),
+			t.Entry("edge", "edge"),
+			t.Entry("reencrypt", "reencrypt"),
+			t.Entry("passthrough", "passthrough"),
+		)
+
+		g.It("should change the traffic split of a weighted route without a reload", func() {
+			ns := oc.KubeFramework().Namespace.Name
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			routerIP, err := waitForRouterIP(oc, "router-haproxy-cfgmgr")
+			o.Expect(err).NotTo(o.HaveOccurred())
+			endpoints := map[string]string{}
+			for _, name := range []string{"insecure-endpoint", "weighted-endpoint"} {
+				ip, err := waitForPodIP(oc, name)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				endpoints[ip] = name
+			}
+
+			g.By("waiting for the healthz endpoint to respond")
+			statsClient := routerstats.ForTestRouter(ns, execPod.Name, routerIP)
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			err = statsClient.WaitForHealthz(timeoutSeconds * time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			host := "weighted.hapcm.test"
+			backend := haproxyconfig.BackendName("", ns, "weighted-route")
+			err = waitForRouteReady(prober, "http", host, routerIP)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			times := 100
+			g.By(fmt.Sprintf("checking that %d requests are split between both services", times))
+			before, err := endpointSessions(statsClient, backend, endpoints)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			err = expectRouteOK(prober, host, routerIP, times)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			after, err := endpointSessions(statsClient, backend, endpoints)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			for _, name := range endpoints {
+				o.Expect(after[name]-before[name]).To(o.BeNumerically(">", 0), "no requests reached %s", name)
+			}
+
+			reloads, err := routerReloads(statsClient)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("moving all the traffic of the route to the alternate backend")
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			route, err := client.Get(context.Background(), "weighted-route", metav1.GetOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			zero, all := int32(0), int32(100)
+			route.Spec.To.Weight = &zero
+			route.Spec.AlternateBackends[0].Weight = &all
+			_, err = client.Update(context.Background(), route, metav1.UpdateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("waiting for haproxy to report the new server weights")
+			err = wait.PollImmediate(time.Second, timeoutSeconds*time.Second, func() (bool, error) {
+				weights, err := endpointColumn(statsClient, backend, endpoints, "weight")
+				if err != nil {
+					e2e.Logf("unable to read the server weights: %v", err)
+					return false, nil
+				}
+				return weights["insecure-endpoint"] == 0 && weights["weighted-endpoint"] > 0, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By(fmt.Sprintf("checking that %d requests only reach the alternate backend", times))
+			before, err = endpointSessions(statsClient, backend, endpoints)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			err = expectRouteOK(prober, host, routerIP, times)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			after, err = endpointSessions(statsClient, backend, endpoints)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(after["insecure-endpoint"] - before["insecure-endpoint"]).To(o.BeZero())
+			o.Expect(after["weighted-endpoint"] - before["weighted-endpoint"]).To(o.BeNumerically(">=", times))
+
+			g.By("checking that the router did not reload")
+			o.Expect(routerReloads(statsClient)).To(o.Equal(reloads))
+		})
+
+		g.It("should add every endpoint of a service with hundreds of endpoints to the backend", func() {
+			ns := oc.KubeFramework().Namespace.Name
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
 
-					err := oc.AsAdmin().Run("create").Args("route", t, name, "--service", serviceName, "--hostname", hostName).Execute()
-					o.Expect(err).NotTo(o.HaveOccurred())
-					err = oc.AsAdmin().Run("label").Args("route", name, "select=haproxy-cfgmgr").Execute()
-					o.Expect(err).NotTo(o.HaveOccurred())
+			routerIP, err := waitForRouterIP(oc, "router-haproxy-cfgmgr")
+			o.Expect(err).NotTo(o.HaveOccurred())
+			endpointIP, err := waitForPodIP(oc, "insecure-endpoint")
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("waiting for the healthz endpoint to respond")
+			statsClient := routerstats.ForTestRouter(ns, execPod.Name, routerIP)
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			err = statsClient.WaitForHealthz(timeoutSeconds * time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
 
-					err = waitForRouteToRespond(ns, execPod.Name, "https", hostName, "/", routerIP, 0)
-					o.Expect(err).NotTo(o.HaveOccurred())
+			// The service has no selector so that the test can manage the
+			// endpoints directly.  Only the first endpoint serves requests,
+			// the others are unroutable addresses that fail their health
+			// checks.
+			g.By("creating a route to a service without a selector")
+			kc := oc.AdminKubeClient()
+			_, err = kc.CoreV1().Services(ns).Create(context.Background(), &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "scale-service"},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{{Name: "http", Port: 8080, TargetPort: intstr.FromInt(8080)}},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			host := "scale.hapcm.test"
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			_, err = client.Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "scale-route",
+					Labels: map[string]string{"select": "haproxy-cfgmgr"},
+				},
+				Spec: routev1.RouteSpec{
+					Host: host,
+					To:   routev1.RouteTargetReference{Kind: "Service", Name: "scale-service"},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			backend := haproxyconfig.BackendName("", ns, "scale-route")
 
-					err = oc.AsAdmin().Run("delete").Args("route", name).Execute()
-					o.Expect(err).NotTo(o.HaveOccurred())
+			setEndpoints := func(n int) sets.String {
+				addrs := sets.NewString(endpointIP)
+				subset := corev1.EndpointSubset{
+					Addresses: []corev1.EndpointAddress{{IP: endpointIP}},
+					Ports:     []corev1.EndpointPort{{Name: "http", Port: 8080, Protocol: corev1.ProtocolTCP}},
+				}
+				for i := 1; i < n; i++ {
+					ip := fmt.Sprintf("198.18.%d.%d", i/250, i%250+1)
+					addrs.Insert(ip)
+					subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: ip})
+				}
+				endpoints := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{Name: "scale-service"},
+					Subsets:    []corev1.EndpointSubset{subset},
 				}
+				_, err := kc.CoreV1().Endpoints(ns).Update(context.Background(), endpoints, metav1.UpdateOptions{})
+				if kapierrs.IsNotFound(err) {
+					_, err = kc.CoreV1().Endpoints(ns).Create(context.Background(), endpoints, metav1.CreateOptions{})
+				}
+				o.Expect(err).NotTo(o.HaveOccurred())
+				return addrs
+			}
+
+			for _, n := range []int{10, 500, 200, 10} {
+				g.By(fmt.Sprintf("setting %d endpoints for the service", n))
+				addrs := setEndpoints(n)
+
+				g.By(fmt.Sprintf("waiting for haproxy to serve exactly the %d endpoints", n))
+				err = wait.PollImmediate(2*time.Second, timeoutSeconds*time.Second, func() (bool, error) {
+					active, stale, err := activeServers(statsClient, backend, addrs)
+					if err != nil {
+						e2e.Logf("unable to read the servers of %s: %v", backend, err)
+						return false, nil
+					}
+					e2e.Logf("backend %s has %d of %d endpoints and %d stale servers", backend, active, addrs.Len(), stale)
+					return active == addrs.Len() && stale == 0, nil
+				})
+				o.Expect(err).NotTo(o.HaveOccurred())
+
+				err = waitForRouteReady(prober, "http", host, routerIP)
+				o.Expect(err).NotTo(o.HaveOccurred())
 			}
 		})
 	})
 })
 
-func waitForRouteToRespond(ns, execPodName, proto, host, abspath, ipaddr string, port int) error {
-	if port == 0 {
-		switch proto {
-		case "http":
-			port = 80
-		case "https":
-			port = 443
-		default:
-			port = 80
+// waitForPodIP waits for the named pod in the test namespace to be assigned
+// an IP address and returns it.
+func waitForPodIP(oc *exutil.CLI, name string) (string, error) {
+	var ip string
+	err := wait.Poll(time.Second, timeoutSeconds*time.Second, func() (bool, error) {
+		pod, err := oc.KubeFramework().ClientSet.CoreV1().Pods(oc.KubeFramework().Namespace.Name).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
 		}
+		if len(pod.Status.PodIP) == 0 {
+			return false, nil
+		}
+		ip = pod.Status.PodIP
+		return true, nil
+	})
+	return ip, err
+}
+
+// waitForRouterIP waits for the named router deployment in the test
+// namespace to complete its rollout and returns the IP address of its ready
+// pod.
+func waitForRouterIP(oc *exutil.CLI, name string) (string, error) {
+	kc := oc.AdminKubeClient()
+	deployment, err := kc.AppsV1().Deployments(oc.KubeFramework().Namespace.Name).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
 	}
-	uri := fmt.Sprintf("%s://%s:%d%s", proto, host, port, abspath)
-	cmd := fmt.Sprintf(`
-		set -e
-		STOP=$(($(date '+%%s') + %d))
-		while [ $(date '+%%s') -lt $STOP ]; do
-			rc=0
-			code=$( curl -k -s -m 5 -o /dev/null -w '%%{http_code}\n' --resolve %s:%d:%s %q ) || rc=$?
-			if [[ "${rc:-0}" -eq 0 ]]; then
-				echo $code
-				if [[ $code -eq 200 ]]; then
-					exit 0
-				fi
-				if [[ $code -ne 503 ]]; then
-					exit 1
-				fi
-			else
-				echo "error ${rc}" 1>&2
-			fi
-			sleep 1
-		done
-		`, timeoutSeconds, host, port, ipaddr, uri)
-	output, err := e2e.RunHostCmd(ns, execPodName, cmd)
+	if err := e2edeployment.WaitForDeploymentComplete(kc, deployment); err != nil {
+		return "", err
+	}
+	pods, err := e2edeployment.GetPodsForDeployment(kc, deployment)
 	if err != nil {
-		return fmt.Errorf("host command failed: %v\n%s", err, output)
+		return "", err
 	}
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	if lines[len(lines)-1] != "200" {
-		return fmt.Errorf("last response from server was not 200:\n%s", output)
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || len(pod.Status.PodIP) == 0 {
+			continue
+		}
+		if ready, _ := testutils.PodRunningReady(&pod); ready {
+			return pod.Status.PodIP, nil
+		}
+	}
+	return "", fmt.Errorf("deployment %s has no ready pod", name)
+}
+
+// endpointSessions returns the total number of sessions that haproxy sent to
+// each of the endpoints of a backend.
+func endpointSessions(c *routerstats.Client, backend string, endpoints map[string]string) (map[string]int64, error) {
+	return endpointColumn(c, backend, endpoints, "stot")
+}
+
+// endpointColumn returns a numeric column of haproxy's stats for the servers
+// of backend, keyed by the endpoint name that the server address maps to in
+// endpoints.  Servers with other addresses, like the unused slots of the
+// config manager, are ignored.
+func endpointColumn(c *routerstats.Client, backend string, endpoints map[string]string, column string) (map[string]int64, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]int64{}
+	for _, server := range stats.Servers(backend) {
+		ip, _, err := net.SplitHostPort(server["addr"])
+		if err != nil {
+			continue
+		}
+		name, ok := endpoints[ip]
+		if !ok {
+			continue
+		}
+		value, err := server.Int(column)
+		if err != nil {
+			return nil, err
+		}
+		values[name] += value
+	}
+	if len(values) != len(endpoints) {
+		return nil, fmt.Errorf("backend %s has servers for %v, expected all of %v", backend, values, endpoints)
+	}
+	return values, nil
+}
+
+// createConfigManagerRoute creates a route of routeType, which is insecure,
+// edge, reencrypt or passthrough, for the config manager router to serve and
+// returns the protocol to request it with.  The route has no certificates so
+// that it can match a blueprint route.
+func createConfigManagerRoute(oc *exutil.CLI, routeType, name, hostName string) string {
+	proto, serviceName := "https", "secure-service"
+	switch routeType {
+	case "insecure":
+		proto, serviceName = "http", "insecure-service"
+	case "edge":
+		serviceName = "insecure-service"
+	}
+
+	if routeType == "insecure" {
+		err := oc.AsAdmin().Run("expose").Args("service", serviceName, "--name", name, "--hostname", hostName, "--labels", "select=haproxy-cfgmgr").Execute()
+		o.Expect(err).NotTo(o.HaveOccurred())
+		return proto
+	}
+	err := oc.AsAdmin().Run("create").Args("route", routeType, name, "--service", serviceName, "--hostname", hostName).Execute()
+	o.Expect(err).NotTo(o.HaveOccurred())
+	err = oc.AsAdmin().Run("label").Args("route", name, "select=haproxy-cfgmgr").Execute()
+	o.Expect(err).NotTo(o.HaveOccurred())
+	return proto
+}
+
+// waitForStableReloads waits until the router has not reloaded haproxy for
+// longer than its minimum reload interval and returns the number of reloads.
+func waitForStableReloads(c *routerstats.Client) (uint64, error) {
+	last, err := routerReloads(c)
+	if err != nil {
+		return 0, err
+	}
+	err = wait.Poll(10*time.Second, timeoutSeconds*time.Second, func() (bool, error) {
+		current, err := routerReloads(c)
+		if err != nil {
+			e2e.Logf("unable to read the router reloads: %v", err)
+			return false, nil
+		}
+		stable := current == last
+		last = current
+		return stable, nil
+	})
+	return last, err
+}
+
+// routerReloads returns the number of times the router reloaded haproxy.
+func routerReloads(c *routerstats.Client) (uint64, error) {
+	reloads, err := c.Reloads()
+	return reloads.Count, err
+}
+
+// activeServers returns the number of servers of backend that are not in
+// maintenance and whose address is one of addrs, and the number of servers
+// that are not in maintenance but have an address of a removed endpoint.
+// The free slots of the config manager are in maintenance and not counted.
+func activeServers(c *routerstats.Client, backend string, addrs sets.String) (int, int, error) {
+	stats, err := c.Stats()
+	if err != nil {
+		return 0, 0, err
+	}
+	servers := stats.Servers(backend)
+	if len(servers) == 0 {
+		return 0, 0, fmt.Errorf("backend %s has no servers", backend)
+	}
+	active, stale := 0, 0
+	for _, server := range servers {
+		if server["status"] == "MAINT" {
+			continue
+		}
+		ip, _, err := net.SplitHostPort(server["addr"])
+		if err != nil {
+			continue
+		}
+		if addrs.Has(ip) {
+			active++
+		} else {
+			stale++
+		}
+	}
+	return active, stale, nil
+}
+
+// expectRouteOK requests host from the router at routerIP times, one request
+// per connection, and fails on the first response that is not 200.
+func expectRouteOK(prober *httpprobe.Prober, host, routerIP string, times int) error {
+	req := httpprobe.Request{Scheme: "http", Host: host, Address: routerIP, Timeout: 5 * time.Second}
+	for i := 0; i < times; i++ {
+		resp, err := prober.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected response from %s: %d", req.URL(), resp.StatusCode)
+		}
 	}
 	return nil
 }
+
+// waitForRouteReady requests host from the router at routerIP until it
+// answers with 200.  The router answers 503 until it serves the route, any
+// other status fails immediately.
+func waitForRouteReady(prober *httpprobe.Prober, scheme, host, routerIP string) error {
+	req := httpprobe.Request{Scheme: scheme, Host: host, Address: routerIP, Timeout: 5 * time.Second}
+	_, err := prober.WaitFor(req, timeoutSeconds*time.Second, func(resp *httpprobe.Response) (bool, error) {
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, nil
+		case http.StatusServiceUnavailable:
+			return false, nil
+		default:
+			return false, fmt.Errorf("unexpected response from %s: %d", req.URL(), resp.StatusCode)
+		}
+	})
+	return err
+}
@@ -0,0 +1,250 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/haproxyconfig"
+	"github.com/openshift/origin/test/extended/router/routerstats"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+const (
+	// convergenceRoutesEnv overrides the number of routes that are moved
+	// between shards.
+	convergenceRoutesEnv = "ROUTER_CONVERGENCE_ROUTES"
+	// convergenceBudgetEnv overrides how long both routers may take to
+	// converge after the routes are moved, as a Go duration.
+	convergenceBudgetEnv = "ROUTER_CONVERGENCE_BUDGET"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc          *exutil.CLI
+		ns          string
+		routerImage string
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			exutil.DumpPodLogsStartingWith("shard-", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-convergence")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("converges within budget when routes are relabelled between shards", func() {
+			routeCount, err := strconv.Atoi(lookupEnv(convergenceRoutesEnv, "200"))
+			o.Expect(err).NotTo(o.HaveOccurred(), "invalid %s", convergenceRoutesEnv)
+			budget, err := time.ParseDuration(lookupEnv(convergenceBudgetEnv, "2m"))
+			o.Expect(err).NotTo(o.HaveOccurred(), "invalid %s", convergenceBudgetEnv)
+
+			g.By("creating a backend")
+			createNetexecBackend(oc.KubeClient(), ns, "convergence")
+
+			g.By("deploying two routers that shard routes by label")
+			shards := map[string]string{"shard-a": "shard=a", "shard-b": "shard=b"}
+			for name, selector := range shards {
+				rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter(name, routerImage, selector), metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+			}
+			routerPods := map[string]corev1.Pod{}
+			for name := range shards {
+				pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=" + name})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(pods.Items).To(o.HaveLen(1))
+				routerPods[name] = pods.Items[0]
+			}
+
+			g.By(fmt.Sprintf("creating %d routes in shard-a", routeCount))
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			for i := 0; i < routeCount; i++ {
+				_, err := client.Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   fmt.Sprintf("route-%d", i),
+						Labels: map[string]string{"shard": "a"},
+					},
+					Spec: routev1.RouteSpec{
+						Host: fmt.Sprintf("route-%d.convergence.example.com", i),
+						To:   routev1.RouteTargetReference{Name: "convergence"},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By("waiting for shard-a to load every route")
+			// The backends of this namespace's insecure routes all
+			// share the prefix of a route with an empty name.
+			prefix := haproxyconfig.BackendName("", ns, "")
+			err = wait.Poll(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+				return routerBackendCountIs(routerPods["shard-a"], prefix, routeCount), nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred(), "shard-a never loaded all of the routes")
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			routerURLs := map[string]string{}
+			for name, pod := range routerPods {
+				routerURLs[name] = fmt.Sprintf("http://%s", net.JoinHostPort(pod.Status.PodIP, "80"))
+			}
+			sampled := []int{0, routeCount / 2, routeCount - 1}
+			for _, i := range sampled {
+				host := fmt.Sprintf("route-%d.convergence.example.com", i)
+				err := waitForRouterOKResponseExec(ns, execPod.Name, routerURLs["shard-a"]+"/echo?msg=ok", host, changeTimeoutSeconds)
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By(fmt.Sprintf("moving every route to shard-b with a convergence budget of %v", budget))
+			start := time.Now()
+			for i := 0; i < routeCount; i++ {
+				_, err := client.Patch(context.Background(), fmt.Sprintf("route-%d", i), types.MergePatchType, []byte(`{"metadata":{"labels":{"shard":"b"}}}`), metav1.PatchOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+			relabelled := time.Since(start)
+
+			err = wait.Poll(time.Second, budget, func() (bool, error) {
+				return routerBackendCountIs(routerPods["shard-a"], prefix, 0) &&
+					routerBackendCountIs(routerPods["shard-b"], prefix, routeCount), nil
+			})
+			converged := time.Since(start)
+			e2e.Logf("relabelled %d routes in %v; router configs converged after %v", routeCount, relabelled, converged)
+			o.Expect(err).NotTo(o.HaveOccurred(), "router configs did not converge within %v", budget)
+
+			g.By("verifying that traffic cut over to shard-b")
+			for _, i := range sampled {
+				host := fmt.Sprintf("route-%d.convergence.example.com", i)
+				err := waitForRouterOKResponseExec(ns, execPod.Name, routerURLs["shard-b"]+"/echo?msg=ok", host, changeTimeoutSeconds)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				err = expectRouteStatusCodeExec(ns, execPod.Name, routerURLs["shard-a"]+"/echo?msg=ok", host, http.StatusServiceUnavailable)
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+			cutover := time.Since(start)
+			e2e.Logf("traffic cut over after %v", cutover)
+			o.Expect(cutover).To(o.BeNumerically("<=", budget), "traffic did not cut over within %v", budget)
+		})
+	})
+})
+
+// labelSelectingRouter returns a single replica router named name that is
+// scoped to its namespace and only serves routes that match selector.  Any
+// extraArgs are appended to the router's arguments.
+func labelSelectingRouter(name, image, selector string, extraArgs ...string) *appsv1.ReplicaSet {
+	one := int64(1)
+	replicas := int32(1)
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": name},
+				},
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: &one,
+					Containers: []corev1.Container{
+						{
+							Env: []corev1.EnvVar{
+								{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+							},
+							Name:  "router",
+							Image: image,
+							Args: append([]string{
+								"-v=4",
+								"--name=" + name,
+								"--namespace=$(POD_NAMESPACE)",
+								"--labels=" + selector,
+								"--stats-port=1936",
+								"--stats-user=" + routerstats.TestRouterUsername,
+								"--stats-password=" + routerstats.TestRouterPassword,
+								"--metrics-type=haproxy",
+							}, extraArgs...),
+							Ports: []corev1.ContainerPort{
+								{ContainerPort: 80},
+								{ContainerPort: 1936, Name: "stats", Protocol: corev1.ProtocolTCP},
+							},
+							ReadinessProbe: &corev1.Probe{
+								InitialDelaySeconds: 10,
+								ProbeHandler: corev1.ProbeHandler{
+									HTTPGet: &corev1.HTTPGetAction{
+										Path: "/healthz/ready",
+										Port: intstr.FromInt(1936),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// routerBackendCountIs reports whether the router pod's configuration has
+// exactly count backends whose names start with prefix.
+func routerBackendCountIs(pod corev1.Pod, prefix string, count int) bool {
+	config, err := getRouterConfig(pod.Namespace, pod.Name)
+	if err != nil {
+		e2e.Logf("failed to read router config: %v, retrying...", err)
+		return false
+	}
+	return len(config.Backends(prefix)) == count
+}
@@ -0,0 +1,189 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	utilnet "k8s.io/utils/net"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		reencryptConfigPath = exutil.FixturePath("testdata", "router", "reencrypt-serving-cert.yaml")
+
+		oc = exutil.NewCLI("router-dualstack")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should serve routes over both IPv4 and IPv6 on dual-stack clusters", func() {
+			network, err := oc.AdminConfigClient().ConfigV1().Networks().Get(context.Background(), "cluster", metav1.GetOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			var cidrs []string
+			for _, entry := range network.Status.ClusterNetwork {
+				cidrs = append(cidrs, entry.CIDR)
+			}
+			if dualStack, err := utilnet.IsDualStackCIDRStrings(cidrs); err != nil || !dualStack {
+				g.Skip(fmt.Sprintf("the cluster network %v is not dual-stack", cidrs))
+			}
+
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			g.By("creating edge, reencrypt and passthrough routes")
+			createNetexecBackend(oc.KubeClient(), ns, "dualstack-edge")
+			err = oc.Run("create").Args("-f", reencryptConfigPath).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+			e2e.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(oc.KubeClient(), "serving-cert", ns))
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			routes := []*routev1.Route{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "dualstack-edge"},
+					Spec: routev1.RouteSpec{
+						Host: "dualstack-edge." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "dualstack-edge"},
+						Port: &routev1.RoutePort{TargetPort: intstr.FromInt(8080)},
+						TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "dualstack-reencrypt"},
+					Spec: routev1.RouteSpec{
+						Host: "dualstack-reencrypt." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "serving-cert"},
+						TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationReencrypt},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "dualstack-passthrough"},
+					Spec: routev1.RouteSpec{
+						Host: "dualstack-passthrough." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "serving-cert"},
+						TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough},
+					},
+				},
+			}
+			for _, route := range routes {
+				_, err := routeClient.Routes(ns).Create(context.Background(), route, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating a router shard")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			for _, route := range routes {
+				_, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, route.Name, shardName, true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q was not admitted", route.Name)
+			}
+
+			// The pods of a private router shard are on the pod
+			// network, so they have an address of each family.
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			addresses := podAddressesByFamily(routerPods[0])
+			o.Expect(addresses).To(o.HaveKey(corev1.IPv4Protocol), "router pod addresses: %v", routerPods[0].Status.PodIPs)
+			o.Expect(addresses).To(o.HaveKey(corev1.IPv6Protocol), "router pod addresses: %v", routerPods[0].Status.PodIPs)
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+
+			for _, route := range routes {
+				// Each family must serve the same response for the
+				// route, negotiated the same way.  The root of the
+				// netexec backend returns the time, so the edge route
+				// is requested with a fixed echo.
+				path := "/"
+				if route.Spec.To.Name == "dualstack-edge" {
+					path = "/echo?msg=dualstack"
+				}
+				responses := map[corev1.IPFamily]*httpprobe.Response{}
+				for _, family := range []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol} {
+					g.By(fmt.Sprintf("requesting route %s over %s from router address %s", route.Name, family, addresses[family]))
+					req := httpprobe.Request{Scheme: "https", Host: route.Spec.Host, Path: path, Address: addresses[family], Timeout: 15 * time.Second}
+					resp, err := prober.WaitForStatus(req, http.StatusOK, changeTimeoutSeconds*time.Second)
+					o.Expect(err).NotTo(o.HaveOccurred(), "route %s did not respond over %s", route.Name, family)
+					responses[family] = resp
+				}
+				v4, v6 := responses[corev1.IPv4Protocol], responses[corev1.IPv6Protocol]
+				o.Expect(string(v6.Body)).To(o.Equal(string(v4.Body)), "route %s served different bodies over IPv4 and IPv6", route.Name)
+				o.Expect(v6.TLS.Version).To(o.Equal(v4.TLS.Version), "route %s negotiated different TLS versions over IPv4 and IPv6", route.Name)
+				o.Expect(v6.TLS.PeerCertificates[0].Raw).To(o.Equal(v4.TLS.PeerCertificates[0].Raw), "route %s presented different certificates over IPv4 and IPv6", route.Name)
+			}
+		})
+	})
+})
+
+// podAddressesByFamily returns the first address of each IP family of pod.
+func podAddressesByFamily(pod corev1.Pod) map[corev1.IPFamily]string {
+	addresses := map[corev1.IPFamily]string{}
+	for _, podIP := range pod.Status.PodIPs {
+		family := corev1.IPv4Protocol
+		if utilnet.IsIPv6String(podIP.IP) {
+			family = corev1.IPv6Protocol
+		}
+		if _, ok := addresses[family]; !ok {
+			addresses[family] = podIP.IP
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,280 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2edeployment "k8s.io/kubernetes/test/e2e/framework/deployment"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	"k8s.io/kubernetes/test/utils/image"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/availability"
+	"github.com/openshift/origin/test/extended/router/haproxyconfig"
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+// churnErrorBudgetEnv overrides the fraction of the requests that may fail
+// while the endpoints of a route churn.
+const churnErrorBudgetEnv = "ROUTER_CHURN_ERROR_BUDGET"
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc          *exutil.CLI
+		ns          string
+		routerImage string
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("router-", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-endpoint-churn")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should keep serving a route while its endpoints churn and converge on the final endpoints [Slow]", func() {
+			errorBudget, err := strconv.ParseFloat(lookupEnv(churnErrorBudgetEnv, "0.05"), 64)
+			o.Expect(err).NotTo(o.HaveOccurred(), "invalid %s", churnErrorBudgetEnv)
+
+			g.By("creating a backend deployment and a route to it")
+			deployment, err := oc.KubeClient().AppsV1().Deployments(ns).Create(context.Background(), netexecDeployment("churn", 3), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(e2edeployment.WaitForDeploymentComplete(oc.KubeClient(), deployment)).NotTo(o.HaveOccurred())
+			_, err = oc.KubeClient().CoreV1().Services(ns).Create(context.Background(), &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "churn",
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "churn"},
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "http",
+							Port:       8080,
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			host := "churn.example.com"
+			_, err = routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns).Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "churn",
+					Labels: map[string]string{"select": "churn"},
+				},
+				Spec: routev1.RouteSpec{
+					Host: host,
+					To:   routev1.RouteTargetReference{Name: "churn"},
+					Port: &routev1.RoutePort{
+						TargetPort: intstr.FromInt(8080),
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("deploying a router")
+			rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter("router-endpoint-churn", routerImage, "select=churn"), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+			pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=router-endpoint-churn"})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(pods.Items).To(o.HaveLen(1))
+			routerPod := pods.Items[0]
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			req := httpprobe.Request{Host: host, Address: routerPod.Status.PodIP, Path: "/hostname", Timeout: 15 * time.Second}
+
+			g.By("waiting for the route to respond")
+			_, err = prober.WaitForStatus(req, http.StatusOK, changeTimeoutSeconds*time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// Requests run for the whole churn, so that they span
+			// every change of the endpoints.
+			stopRequests := availability.StartRouteAvailabilityMonitor("endpoint-churn", prober, req)
+			defer stopRequests()
+
+			// Each step scales the deployment and, without waiting
+			// for the rollout, deletes one of its pods, so that
+			// endpoints are added and removed while earlier changes
+			// are still in flight.  The last pod is never deleted, a
+			// route without endpoints cannot be served by any router.
+			for _, replicas := range []int32{6, 2, 5, 1, 4, 2, 6} {
+				replicas := replicas
+				g.By(fmt.Sprintf("scaling the backend to %d replicas and deleting one of its pods unless it is the last", replicas))
+				deployment, err = e2edeployment.UpdateDeploymentWithRetries(oc.KubeClient(), ns, "churn", func(d *appsv1.Deployment) {
+					d.Spec.Replicas = &replicas
+				})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				time.Sleep(5 * time.Second)
+				pods, err := oc.KubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=churn"})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				var running []string
+				for _, pod := range pods.Items {
+					if pod.DeletionTimestamp == nil {
+						running = append(running, pod.Name)
+					}
+				}
+				if len(running) > 1 {
+					err := oc.KubeClient().CoreV1().Pods(ns).Delete(context.Background(), running[0], metav1.DeleteOptions{})
+					o.Expect(err).NotTo(o.HaveOccurred())
+				}
+				time.Sleep(5 * time.Second)
+			}
+
+			g.By("scaling the backend to its final 3 replicas")
+			final := int32(3)
+			deployment, err = e2edeployment.UpdateDeploymentWithRetries(oc.KubeClient(), ns, "churn", func(d *appsv1.Deployment) {
+				d.Spec.Replicas = &final
+			})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(e2edeployment.WaitForDeploymentComplete(oc.KubeClient(), deployment)).NotTo(o.HaveOccurred())
+			report := stopRequests()
+
+			g.By("checking the error rate of the requests during the churn")
+			o.Expect(report.Requests).To(o.BeNumerically(">", 0))
+			o.Expect(report.FailureRate()).To(o.BeNumerically("<=", errorBudget), "more requests failed than the budget of %v: %s", errorBudget, report)
+
+			g.By("waiting for the router to converge on the final endpoints")
+			var (
+				expected  []string
+				podNames  = map[string]bool{}
+				addresses []string
+			)
+			err = wait.PollImmediate(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+				pods, err := oc.KubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=churn"})
+				if err != nil {
+					return false, err
+				}
+				expected = nil
+				podNames = map[string]bool{}
+				for _, pod := range pods.Items {
+					if pod.DeletionTimestamp != nil || !podutil.IsPodReady(&pod) {
+						continue
+					}
+					expected = append(expected, net.JoinHostPort(pod.Status.PodIP, "8080"))
+					podNames[pod.Name] = true
+				}
+				config, err := getRouterConfig(routerPod.Namespace, routerPod.Name)
+				if err != nil {
+					e2e.Logf("failed to read router config: %v, retrying...", err)
+					return false, nil
+				}
+				backend := config.Backend(haproxyconfig.BackendName("", ns, "churn"))
+				if backend == nil {
+					return false, nil
+				}
+				addresses = backend.ServerAddresses()
+				sort.Strings(expected)
+				sort.Strings(addresses)
+				return len(expected) == int(final) && fmt.Sprint(addresses) == fmt.Sprint(expected), nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred(), "the router has servers %v, the backend has ready endpoints %v", addresses, expected)
+
+			g.By("checking that every request is served by one of the final pods")
+			for i := 0; i < 20; i++ {
+				resp, err := prober.Do(req)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(resp.StatusCode).To(o.Equal(http.StatusOK))
+				o.Expect(podNames).To(o.HaveKey(string(resp.Body)))
+			}
+		})
+	})
+})
+
+// netexecDeployment returns a deployment of replicas agnhost netexec pods
+// that are labelled app=name and listen on port 8080.
+func netexecDeployment(name string, replicas int32) *appsv1.Deployment {
+	podLabels := map[string]string{"app": name}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: podLabels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: podLabels,
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: e2epod.GetRestrictedPodSecurityContext(),
+					Containers: []corev1.Container{
+						{
+							Name:            name,
+							Image:           image.GetE2EImage(image.Agnhost),
+							Args:            []string{"netexec", "--http-port", "8080"},
+							Ports:           []corev1.ContainerPort{{ContainerPort: 8080}},
+							SecurityContext: e2epod.GetRestrictedContainerSecurityContext(),
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									TCPSocket: &corev1.TCPSocketAction{
+										Port: intstr.FromInt(8080),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,188 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc = exutil.NewCLI("router-error-pages")
+
+		shardName      string // computed
+		errorPagesName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+		if len(errorPagesName) > 0 {
+			if err := oc.AdminKubeClient().CoreV1().ConfigMaps("openshift-config").Delete(context.Background(), errorPagesName, metav1.DeleteOptions{}); err != nil {
+				e2e.Logf("deleting error pages configmap failed: %v\n", err)
+			}
+			errorPagesName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should serve the custom error pages of the ingresscontroller", func() {
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			// The pages are complete responses, and their bodies are
+			// unique to the test so that they cannot be mistaken for
+			// the default pages.
+			bodies := map[int]string{
+				http.StatusServiceUnavailable: fmt.Sprintf("custom 503 page of %s", ns),
+				http.StatusNotFound:           fmt.Sprintf("custom 404 page of %s", ns),
+			}
+			page := func(status int) string {
+				return strings.Join([]string{
+					fmt.Sprintf("HTTP/1.0 %d %s", status, http.StatusText(status)),
+					"Pragma: no-cache",
+					"Cache-Control: private, max-age=0, no-cache, no-store",
+					"Connection: close",
+					"Content-Type: text/plain",
+					"",
+					bodies[status],
+				}, "\r\n")
+			}
+
+			g.By("creating the error pages configmap in openshift-config")
+			cm, err := oc.AdminKubeClient().CoreV1().ConfigMaps("openshift-config").Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ns + "-error-pages",
+				},
+				Data: map[string]string{
+					"error-page-503.http": page(http.StatusServiceUnavailable),
+					"error-page-404.http": page(http.StatusNotFound),
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			errorPagesName = cm.Name
+
+			g.By("creating a route to a service without endpoints")
+			_, err = oc.KubeClient().CoreV1().Services(ns).Create(context.Background(), &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "no-endpoints",
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "no-endpoints"},
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "http",
+							Port:       8080,
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			_, err = routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "no-endpoints",
+				},
+				Spec: routev1.RouteSpec{
+					Host: "no-endpoints." + shardFQDN,
+					To:   routev1.RouteTargetReference{Name: "no-endpoints"},
+					Port: &routev1.RoutePort{
+						TargetPort: intstr.FromInt(8080),
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating a router shard with the custom error pages")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.HttpErrorCodePages = configv1.ConfigMapNameReference{Name: errorPagesName}
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			_, err = waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, "no-endpoints", shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerIP := routerPods[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+
+			g.By("checking that a route without endpoints gets the custom 503 page")
+			req := httpprobe.Request{Host: "no-endpoints." + shardFQDN, Address: routerIP, Timeout: 15 * time.Second}
+			resp, err := prober.WaitFor(req, changeTimeoutSeconds*time.Second, func(resp *httpprobe.Response) (bool, error) {
+				return resp.StatusCode == http.StatusServiceUnavailable && strings.Contains(string(resp.Body), bodies[http.StatusServiceUnavailable]), nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred(), "the router never served the custom 503 page")
+			o.Expect(resp.Header.Get("Content-Type")).To(o.Equal("text/plain"))
+
+			// The router answers a host without a route with one of the
+			// customizable statuses.
+			g.By("checking that an unknown host gets the custom page of its status")
+			for _, scheme := range []string{"http", "https"} {
+				req := httpprobe.Request{Scheme: scheme, Host: "unknown." + shardFQDN, Address: routerIP, Timeout: 15 * time.Second}
+				resp, err := prober.Do(req)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(resp.StatusCode).To(o.BeElementOf(http.StatusServiceUnavailable, http.StatusNotFound), "%s request for an unknown host", scheme)
+				o.Expect(string(resp.Body)).To(o.ContainSubstring(bodies[resp.StatusCode]), "%s request for an unknown host", scheme)
+			}
+		})
+	})
+})
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+// externalEndpointEnv, when set to true, makes the tests that probe the
+// default router connect to its load balancer from the test process, instead
+// of to a router pod from an exec pod, so that they cover the path that
+// clients outside of the cluster take.
+const externalEndpointEnv = "ROUTER_TEST_EXTERNAL_ENDPOINT"
+
+// externalEndpointEnabled returns whether externalEndpointEnv is set to true.
+func externalEndpointEnabled() bool {
+	enabled, err := strconv.ParseBool(lookupEnv(externalEndpointEnv, "false"))
+	o.Expect(err).NotTo(o.HaveOccurred(), "invalid %s", externalEndpointEnv)
+	return enabled
+}
+
+// defaultRouterProber returns a prober for the default router and the address
+// to send its requests to.  By default the prober relays through an exec pod
+// in ns to the IP of a default router pod.  If externalEndpointEnabled, the
+// prober connects directly to the load balancer of the default router, and
+// the test is skipped if the default router is not published by a load
+// balancer.  Either way, requests set the route in Host, and in ServerName
+// when it differs.  The returned function deletes the exec pod, if any.
+func defaultRouterProber(oc *exutil.CLI, ns string) (*httpprobe.Prober, string, func()) {
+	if externalEndpointEnabled() {
+		address := waitForDefaultRouterLoadBalancer(oc)
+		e2e.Logf("probing the default router through its load balancer at %s", address)
+		return httpprobe.NewDirect(), address, func() {}
+	}
+
+	routerPods, err := shard.GetRouterShardPods(oc, "default")
+	o.Expect(err).NotTo(o.HaveOccurred())
+	o.Expect(routerPods).NotTo(o.BeEmpty())
+
+	execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+	cleanup := func() {
+		oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+	}
+	return httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name), routerPods[0].Status.PodIP, cleanup
+}
+
+// waitForDefaultRouterLoadBalancer returns the IP or host name of the load
+// balancer of the default router, or skips the test if the default router
+// has none.
+func waitForDefaultRouterLoadBalancer(oc *exutil.CLI) string {
+	service, err := getRouterService(oc, time.Minute, "router-default")
+	o.Expect(err).NotTo(o.HaveOccurred())
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		g.Skip("Skip probing the default router externally, it is not published by a load balancer service.")
+	}
+
+	var address string
+	err = wait.PollImmediate(5*time.Second, 5*time.Minute, func() (bool, error) {
+		service, err := getRouterService(oc, time.Minute, "router-default")
+		if err != nil {
+			return false, err
+		}
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if len(ingress.Hostname) > 0 {
+				address = ingress.Hostname
+				return true, nil
+			}
+			if len(ingress.IP) > 0 {
+				address = ingress.IP
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	o.Expect(err).NotTo(o.HaveOccurred(), "the load balancer of the default router was not provisioned")
+	return address
+}
@@ -0,0 +1,178 @@
+package haproxyconfig
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Section is a single section of an haproxy configuration file, such as
+// "defaults" or "backend be_http:ns:name".
+type Section struct {
+	// Kind is the section keyword, for example "global", "defaults",
+	// "frontend" or "backend".
+	Kind string
+	// Name is the name following the section keyword, if any.
+	Name string
+	// Lines holds the directives in the section with surrounding
+	// whitespace and trailing comments removed.
+	Lines []string
+}
+
+// Get returns the arguments of the last directive in the section that
+// starts with keyword, and whether such a directive was found.  Keyword may
+// consist of several words, for example "timeout server".  The last
+// directive is returned because that is the one haproxy honours.
+func (s *Section) Get(keyword string) (string, bool) {
+	value, found := "", false
+	for _, line := range s.Lines {
+		if line == keyword {
+			value, found = "", true
+		} else if strings.HasPrefix(line, keyword+" ") {
+			value, found = strings.TrimSpace(strings.TrimPrefix(line, keyword)), true
+		}
+	}
+	return value, found
+}
+
+// GetAll returns the arguments of every directive in the section that
+// starts with keyword, in the order in which they appear.
+func (s *Section) GetAll(keyword string) []string {
+	var values []string
+	for _, line := range s.Lines {
+		if line == keyword {
+			values = append(values, "")
+		} else if strings.HasPrefix(line, keyword+" ") {
+			values = append(values, strings.TrimSpace(strings.TrimPrefix(line, keyword)))
+		}
+	}
+	return values
+}
+
+// ServerAddresses returns the address of every server directive in the
+// section, in the order in which they appear.  Disabled servers, like the
+// placeholder servers of the dynamic configuration manager, are skipped.
+func (s *Section) ServerAddresses() []string {
+	var addresses []string
+	for _, server := range s.GetAll("server") {
+		fields := strings.Fields(server)
+		if len(fields) < 2 {
+			continue
+		}
+		disabled := false
+		for _, field := range fields[2:] {
+			if field == "disabled" {
+				disabled = true
+			}
+		}
+		if !disabled {
+			addresses = append(addresses, fields[1])
+		}
+	}
+	return addresses
+}
+
+// Config is a parsed haproxy configuration file.
+type Config struct {
+	Sections []*Section
+}
+
+// Parse splits the contents of an haproxy configuration file into sections.
+// It does not validate the configuration; directives that appear before the
+// first section keyword are ignored.
+func Parse(contents string) *Config {
+	config := &Config{}
+	var current *Section
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "global", "defaults", "frontend", "backend", "listen", "userlist", "peers", "resolvers", "cache", "program":
+			current = &Section{Kind: fields[0]}
+			if len(fields) > 1 {
+				current.Name = fields[1]
+			}
+			config.Sections = append(config.Sections, current)
+			continue
+		}
+		if current != nil {
+			current.Lines = append(current.Lines, strings.Join(fields, " "))
+		}
+	}
+
+	return config
+}
+
+// Section returns the first section of the given kind and name, or nil if
+// there is none.  For unnamed sections such as "global", name should be
+// empty.
+func (c *Config) Section(kind, name string) *Section {
+	for _, s := range c.Sections {
+		if s.Kind == kind && s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Defaults returns the first defaults section, or nil if there is none.
+func (c *Config) Defaults() *Section {
+	for _, s := range c.Sections {
+		if s.Kind == "defaults" {
+			return s
+		}
+	}
+	return nil
+}
+
+// Backend returns the backend with the given name, or nil if there is none.
+func (c *Config) Backend(name string) *Section {
+	return c.Section("backend", name)
+}
+
+// Backends returns all of the backend sections whose name starts with
+// prefix, in the order in which they appear.
+func (c *Config) Backends(prefix string) []*Section {
+	var backends []*Section
+	for _, s := range c.Sections {
+		if s.Kind == "backend" && strings.HasPrefix(s.Name, prefix) {
+			backends = append(backends, s)
+		}
+	}
+	return backends
+}
+
+// Frontend returns the frontend with the given name, or nil if there is
+// none.
+func (c *Config) Frontend(name string) *Section {
+	return c.Section("frontend", name)
+}
+
+// BackendName returns the name of the backend that the OpenShift router
+// generates for the route with the given namespace, name and TLS
+// termination type.  An empty termination denotes an insecure route.
+func BackendName(termination, namespace, name string) string {
+	var prefix string
+	switch termination {
+	case "":
+		prefix = "be_http"
+	case "edge":
+		prefix = "be_edge_http"
+	case "reencrypt":
+		prefix = "be_secure"
+	case "passthrough":
+		prefix = "be_tcp"
+	default:
+		prefix = "be_" + termination
+	}
+	return fmt.Sprintf("%s:%s:%s", prefix, namespace, name)
+}
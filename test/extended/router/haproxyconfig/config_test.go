@@ -0,0 +1,111 @@
+package haproxyconfig_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openshift/origin/test/extended/router/haproxyconfig"
+)
+
+const sample = `global
+  maxconn 20000
+  # a comment
+  daemon
+
+defaults
+  timeout connect 5s
+  timeout server 30s # trailing comment
+  timeout server 5s
+
+frontend public
+  bind :80
+  default_backend openshift_default
+
+backend be_http:ns:default-timeout
+  mode http
+  server pod:a 10.0.0.1:8080 weight 256
+  server pod:b 10.0.0.2:8080 weight 256 check inter 5000ms
+  server _dynamic-pod-1 172.4.0.4:8765 weight 0 disabled check inter 5000ms
+
+backend be_edge_http:ns:longer-timeout
+  mode http
+  timeout server  20s
+`
+
+func TestParseSections(t *testing.T) {
+	config := haproxyconfig.Parse(sample)
+
+	var got [][2]string
+	for _, s := range config.Sections {
+		got = append(got, [2]string{s.Kind, s.Name})
+	}
+	expected := [][2]string{
+		{"global", ""},
+		{"defaults", ""},
+		{"frontend", "public"},
+		{"backend", "be_http:ns:default-timeout"},
+		{"backend", "be_edge_http:ns:longer-timeout"},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("unexpected sections (-want +got):\n%s", diff)
+	}
+
+	if global := config.Section("global", ""); global == nil || len(global.Lines) != 2 {
+		t.Fatalf("expected comments to be dropped from global; got %+v", global)
+	}
+}
+
+func TestSectionGet(t *testing.T) {
+	config := haproxyconfig.Parse(sample)
+
+	if value, ok := config.Defaults().Get("timeout server"); !ok || value != "5s" {
+		t.Errorf("expected the last defaults timeout server to win; got %q, %v", value, ok)
+	}
+	if values := config.Defaults().GetAll("timeout server"); !cmp.Equal(values, []string{"30s", "5s"}) {
+		t.Errorf("unexpected timeout server values %q", values)
+	}
+	if value, ok := config.Section("global", "").Get("daemon"); !ok || value != "" {
+		t.Errorf("expected a bare daemon directive; got %q, %v", value, ok)
+	}
+
+	backend := config.Backend(haproxyconfig.BackendName("edge", "ns", "longer-timeout"))
+	if backend == nil {
+		t.Fatalf("expected to find the edge backend")
+	}
+	if value, ok := backend.Get("timeout server"); !ok || value != "20s" {
+		t.Errorf("expected the backend timeout server to be 20s; got %q, %v", value, ok)
+	}
+
+	backend = config.Backend(haproxyconfig.BackendName("", "ns", "default-timeout"))
+	if backend == nil {
+		t.Fatalf("expected to find the insecure backend")
+	}
+	if value, ok := backend.Get("timeout server"); ok {
+		t.Errorf("expected no timeout server in the backend; got %q", value)
+	}
+	if value, ok := backend.Get("mode"); !ok || value != "http" {
+		t.Errorf("expected the backend mode to be http; got %q, %v", value, ok)
+	}
+	if backends := config.Backends("be_"); len(backends) != 2 {
+		t.Errorf("expected 2 backends, got %d", len(backends))
+	}
+	if backends := config.Backends("be_http:ns:"); len(backends) != 1 {
+		t.Errorf("expected 1 insecure backend, got %d", len(backends))
+	}
+	if config.Backend("be_tcp:ns:missing") != nil {
+		t.Errorf("expected no backend for a missing route")
+	}
+}
+
+func TestSectionServerAddresses(t *testing.T) {
+	config := haproxyconfig.Parse(sample)
+
+	backend := config.Backend(haproxyconfig.BackendName("", "ns", "default-timeout"))
+	if addresses := backend.ServerAddresses(); !cmp.Equal(addresses, []string{"10.0.0.1:8080", "10.0.0.2:8080"}) {
+		t.Errorf("expected the enabled servers only; got %q", addresses)
+	}
+	backend = config.Backend(haproxyconfig.BackendName("edge", "ns", "longer-timeout"))
+	if addresses := backend.ServerAddresses(); len(addresses) != 0 {
+		t.Errorf("expected no servers; got %q", addresses)
+	}
+}
@@ -0,0 +1,196 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc = exutil.NewCLI("router-header-policy")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should apply the forwarded header policy of the ingresscontroller unless a route overrides it", func() {
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			g.By("creating a backend that echoes the request headers")
+			createHeaderEchoBackend(oc.KubeClient(), ns, "header-echo")
+
+			// The ingresscontroller never sets the forwarded headers,
+			// the first route inherits that policy and the others
+			// override it with the set-forwarded-headers annotation.
+			routes := []struct {
+				name   string
+				policy string
+			}{
+				{name: "policy-default"},
+				{name: "policy-append", policy: "append"},
+				{name: "policy-replace", policy: "replace"},
+				{name: "policy-if-none", policy: "if-none"},
+			}
+			g.By("creating routes with and without the set-forwarded-headers annotation")
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			for _, route := range routes {
+				annotations := map[string]string{}
+				if len(route.policy) > 0 {
+					annotations["haproxy.router.openshift.io/set-forwarded-headers"] = route.policy
+				}
+				_, err := routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        route.name,
+						Annotations: annotations,
+					},
+					Spec: routev1.RouteSpec{
+						Host: route.name + "." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "header-echo"},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8676),
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating a router shard that never sets forwarded headers and sets a unique id header")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.HTTPHeaders = &operatorv1.IngressControllerHTTPHeaders{
+					ForwardedHeaderPolicy: operatorv1.NeverHTTPHeaderPolicy,
+					UniqueId: operatorv1.IngressControllerHTTPUniqueIdHeaderPolicy{
+						Name: "X-Request-Id",
+					},
+				}
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			for _, route := range routes {
+				_, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, route.name, shardName, true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q was not admitted", route.name)
+			}
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerIP := routerPods[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			execPod, err = oc.AdminKubeClient().CoreV1().Pods(ns).Get(context.Background(), execPod.Name, metav1.GetOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			clientIP := execPod.Status.PodIP
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+
+			// echoedRequest requests host, with the given
+			// X-Forwarded-For header if it is not empty, and parses
+			// the request that the backend received.
+			echoedRequest := func(host, forwardedFor string) *http.Request {
+				req := httpprobe.Request{Host: host, Address: routerIP, Timeout: 15 * time.Second}
+				if len(forwardedFor) > 0 {
+					req.Header = http.Header{"X-Forwarded-For": []string{forwardedFor}}
+				}
+				resp, err := prober.WaitForStatus(req, http.StatusOK, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				echoed, err := http.ReadRequest(bufio.NewReader(strings.NewReader(string(resp.Body))))
+				o.Expect(err).NotTo(o.HaveOccurred())
+				return echoed
+			}
+			// forwardedFor returns the addresses of the X-Forwarded-For
+			// headers of req in order.
+			forwardedFor := func(req *http.Request) []string {
+				var addresses []string
+				for _, value := range req.Header.Values("X-Forwarded-For") {
+					for _, address := range strings.Split(value, ",") {
+						addresses = append(addresses, strings.TrimSpace(address))
+					}
+				}
+				return addresses
+			}
+
+			spoofed := "192.0.2.1"
+			for _, tc := range []struct {
+				route string
+				// withHeader and withoutHeader are the addresses
+				// that the backend receives for a request with
+				// and without an X-Forwarded-For header.
+				withHeader    []string
+				withoutHeader []string
+			}{
+				{route: "policy-default", withHeader: []string{spoofed}, withoutHeader: nil},
+				{route: "policy-append", withHeader: []string{spoofed, clientIP}, withoutHeader: []string{clientIP}},
+				{route: "policy-replace", withHeader: []string{clientIP}, withoutHeader: []string{clientIP}},
+				{route: "policy-if-none", withHeader: []string{spoofed}, withoutHeader: []string{clientIP}},
+			} {
+				host := tc.route + "." + shardFQDN
+				g.By(fmt.Sprintf("checking the X-Forwarded-For headers that route %s passes to the backend", tc.route))
+				req := echoedRequest(host, spoofed)
+				o.Expect(forwardedFor(req)).To(o.Equal(tc.withHeader), "request with X-Forwarded-For; all headers: %#v", req.Header)
+				req = echoedRequest(host, "")
+				o.Expect(forwardedFor(req)).To(o.Equal(tc.withoutHeader), "request without X-Forwarded-For; all headers: %#v", req.Header)
+
+				o.Expect(req.Header.Values("X-Request-Id")).To(o.HaveLen(1), "expected a unique id header; all headers: %#v", req.Header)
+				o.Expect(req.Header.Get("X-Request-Id")).NotTo(o.BeEmpty())
+			}
+		})
+	})
+})
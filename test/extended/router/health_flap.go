@@ -0,0 +1,292 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2edeployment "k8s.io/kubernetes/test/e2e/framework/deployment"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/availability"
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+// healthPropagationTimeoutEnv overrides how long the router may take to
+// follow a change of the readiness of the endpoints of a route.
+const healthPropagationTimeoutEnv = "ROUTER_HEALTH_PROPAGATION_TIMEOUT"
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc = exutil.NewCLI("router-health-flap")
+
+		shardName      string // computed
+		errorPagesName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+		if len(errorPagesName) > 0 {
+			if err := oc.AdminKubeClient().CoreV1().ConfigMaps("openshift-config").Delete(context.Background(), errorPagesName, metav1.DeleteOptions{}); err != nil {
+				e2e.Logf("deleting error pages configmap failed: %v\n", err)
+			}
+			errorPagesName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should return 503 only while no endpoints of a route are ready and recover within a bounded time", func() {
+			// The timeout covers the readiness probe, the endpoints
+			// controller and the reload of the router.
+			timeout, err := time.ParseDuration(lookupEnv(healthPropagationTimeoutEnv, "30s"))
+			o.Expect(err).NotTo(o.HaveOccurred(), "invalid %s", healthPropagationTimeoutEnv)
+
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+			host := "flap." + shardFQDN
+
+			// The body is unique to the test so that the 503 of a
+			// route without ready endpoints cannot be mistaken for
+			// any other 503.
+			unavailableBody := fmt.Sprintf("custom 503 page of %s", ns)
+			g.By("creating an error pages configmap in openshift-config")
+			cm, err := oc.AdminKubeClient().CoreV1().ConfigMaps("openshift-config").Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ns + "-error-pages",
+				},
+				Data: map[string]string{
+					"error-page-503.http": strings.Join([]string{
+						"HTTP/1.0 503 Service Unavailable",
+						"Pragma: no-cache",
+						"Cache-Control: private, max-age=0, no-cache, no-store",
+						"Connection: close",
+						"Content-Type: text/plain",
+						"",
+						unavailableBody,
+					}, "\r\n"),
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			errorPagesName = cm.Name
+
+			// A backend pod is ready unless /tmp/unready exists, so
+			// that the test can flap its readiness while it keeps
+			// serving.
+			g.By("creating a backend deployment whose readiness can be toggled and a route to it")
+			deployment := netexecDeployment("flap", 2)
+			deployment.Spec.Template.Spec.Containers[0].ReadinessProbe = &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					Exec: &corev1.ExecAction{
+						Command: []string{"sh", "-c", "test ! -e /tmp/unready"},
+					},
+				},
+				PeriodSeconds:    1,
+				FailureThreshold: 1,
+				SuccessThreshold: 1,
+			}
+			deployment, err = oc.KubeClient().AppsV1().Deployments(ns).Create(context.Background(), deployment, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(e2edeployment.WaitForDeploymentComplete(oc.KubeClient(), deployment)).NotTo(o.HaveOccurred())
+			_, err = oc.KubeClient().CoreV1().Services(ns).Create(context.Background(), &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "flap",
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "flap"},
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "http",
+							Port:       8080,
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			_, err = routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "flap",
+				},
+				Spec: routev1.RouteSpec{
+					Host: host,
+					To:   routev1.RouteTargetReference{Name: "flap"},
+					Port: &routev1.RoutePort{
+						TargetPort: intstr.FromInt(8080),
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			pods, err := oc.KubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=flap"})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(pods.Items).To(o.HaveLen(2))
+			stable, flapping := pods.Items[0].Name, pods.Items[1].Name
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating a router shard with a custom 503 page")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.HttpErrorCodePages = configv1.ConfigMapNameReference{Name: errorPagesName}
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			_, err = waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, "flap", shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerIP := routerPods[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			req := httpprobe.Request{Host: host, Address: routerIP, Path: "/hostname", Timeout: 10 * time.Second}
+
+			g.By("waiting for the route to respond")
+			_, err = prober.WaitForStatus(req, http.StatusOK, changeTimeoutSeconds*time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			setReady := func(pod string, ready bool) {
+				cmd := "touch /tmp/unready"
+				if ready {
+					cmd = "rm -f /tmp/unready"
+				}
+				_, err := e2e.RunHostCmd(ns, pod, cmd)
+				o.Expect(err).NotTo(o.HaveOccurred(), "failed to set the readiness of %s to %v", pod, ready)
+			}
+			// readyEndpoints counts the ready endpoints in the
+			// endpointslices of the service, which the router
+			// follows.
+			readyEndpoints := func() int {
+				slices, err := oc.KubeClient().DiscoveryV1().EndpointSlices(ns).List(context.Background(), metav1.ListOptions{LabelSelector: discoveryv1.LabelServiceName + "=flap"})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				var ready int
+				for _, slice := range slices.Items {
+					for _, endpoint := range slice.Endpoints {
+						if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+							ready++
+						}
+					}
+				}
+				return ready
+			}
+			// waitForOnlyServedBy waits until pod answers enough
+			// consecutive requests that the other pod would almost
+			// certainly have answered one of them if the router still
+			// had it.
+			waitForOnlyServedBy := func(pod string) {
+				var consecutive int
+				_, err := prober.WaitFor(req, timeout, func(resp *httpprobe.Response) (bool, error) {
+					if resp.StatusCode != http.StatusOK || string(resp.Body) != pod {
+						consecutive = 0
+						return false, nil
+					}
+					consecutive++
+					return consecutive >= 10, nil
+				})
+				o.Expect(err).NotTo(o.HaveOccurred(), "the route was not served only by %s within %s", pod, timeout)
+			}
+			waitForServedBy := func(pod string) {
+				_, err := prober.WaitFor(req, timeout, func(resp *httpprobe.Response) (bool, error) {
+					return resp.StatusCode == http.StatusOK && string(resp.Body) == pod, nil
+				})
+				o.Expect(err).NotTo(o.HaveOccurred(), "the route was not served by %s within %s", pod, timeout)
+			}
+			isUnavailablePage := func(resp *httpprobe.Response) (bool, error) {
+				return resp.StatusCode == http.StatusServiceUnavailable && strings.Contains(string(resp.Body), unavailableBody), nil
+			}
+
+			for cycle := 1; cycle <= 3; cycle++ {
+				// The flapping pod keeps serving while it is
+				// unready, so the route must stay available
+				// whichever of the pods the router still has.
+				g.By(fmt.Sprintf("cycle %d: flapping the readiness of one endpoint while the other stays ready", cycle))
+				stopRequests := availability.StartRouteAvailabilityMonitor(fmt.Sprintf("health-flap-%d", cycle), prober, req)
+				defer stopRequests()
+				setReady(flapping, false)
+				waitForOnlyServedBy(stable)
+				setReady(flapping, true)
+				waitForServedBy(flapping)
+				report := stopRequests()
+				o.Expect(report.Requests).To(o.BeNumerically(">", 0))
+				o.Expect(report.Failures).To(o.BeZero(), "requests failed while an endpoint was ready: %s", report)
+
+				g.By(fmt.Sprintf("cycle %d: making every endpoint unready", cycle))
+				setReady(stable, false)
+				setReady(flapping, false)
+				start := time.Now()
+				_, err := prober.WaitFor(req, timeout, isUnavailablePage)
+				o.Expect(err).NotTo(o.HaveOccurred(), "the router did not serve the custom 503 page within %s of every endpoint becoming unready", timeout)
+				e2e.Logf("the router served the custom 503 page %s after every endpoint became unready", time.Since(start).Round(time.Millisecond))
+				// The router follows the endpoints, so by the
+				// time it has none they are all unready.
+				o.Expect(readyEndpoints()).To(o.BeZero(), "the router served a 503 while an endpoint was ready")
+				for i := 0; i < 5; i++ {
+					resp, err := prober.Do(req)
+					o.Expect(err).NotTo(o.HaveOccurred())
+					unavailable, _ := isUnavailablePage(resp)
+					o.Expect(unavailable).To(o.BeTrue(), "the router served status %d instead of the custom 503 page while no endpoint was ready", resp.StatusCode)
+				}
+
+				g.By(fmt.Sprintf("cycle %d: making one endpoint ready again", cycle))
+				setReady(stable, true)
+				start = time.Now()
+				waitForServedBy(stable)
+				e2e.Logf("the route recovered %s after an endpoint became ready", time.Since(start).Round(time.Millisecond))
+				setReady(flapping, true)
+				waitForServedBy(flapping)
+			}
+		})
+	})
+})
@@ -0,0 +1,287 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/certgen"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+const (
+	// enableHTTP2Annotation enables or disables HTTP/2 for the router of
+	// an ingresscontroller.
+	enableHTTP2Annotation = "ingress.operator.openshift.io/default-enable-http2"
+
+	// http2StreamSeconds is how long the backend holds the response of
+	// the live HTTP/2 stream, which must outlast the rollout of the
+	// router.
+	http2StreamSeconds = 120
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc = exutil.NewCLI("router-http2-downgrade")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should downgrade new connections to HTTP/1.1 without failing live HTTP/2 streams when HTTP/2 is disabled", func() {
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+			host := "http2-downgrade." + shardFQDN
+
+			g.By("creating a backend that can delay its responses")
+			createNetexecBackend(oc.KubeClient(), ns, "http2-downgrade")
+
+			// The router only negotiates HTTP/2 for routes with a
+			// custom certificate.
+			notBefore := time.Now().Add(-24 * time.Hour)
+			notAfter := time.Now().Add(24 * time.Hour)
+			_, tlsCrtData, tlsPrivateKey, err := certgen.GenerateKeyPair(notBefore, notAfter, host)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			pemKey, err := certgen.MarshalPrivateKeyToDERFormat(tlsPrivateKey)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			pemCrt, err := certgen.MarshalCertToPEMString(tlsCrtData)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating an edge route with a custom certificate")
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			_, err = routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "http2-downgrade",
+					Annotations: map[string]string{
+						"haproxy.router.openshift.io/timeout": "5m",
+					},
+				},
+				Spec: routev1.RouteSpec{
+					Host: host,
+					To:   routev1.RouteTargetReference{Name: "http2-downgrade"},
+					Port: &routev1.RoutePort{
+						TargetPort: intstr.FromInt(8080),
+					},
+					TLS: &routev1.TLSConfig{
+						Termination: routev1.TLSTerminationEdge,
+						Certificate: pemCrt,
+						Key:         pemKey,
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating a router shard with HTTP/2 enabled")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			err = setRouterShardHTTP2(oc, shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			err = waitForRouterShardHTTP2(oc, shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred(), "router shard with HTTP/2 enabled did not rollout")
+			_, err = waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, "http2-downgrade", shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred(), "route was not admitted")
+
+			// The internal service of the shard keeps its address
+			// while the router pods are replaced.
+			service, err := oc.AdminKubeClient().CoreV1().Services("openshift-ingress").Get(context.Background(), "router-internal-"+shardName, metav1.GetOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			routerIP := service.Spec.ClusterIP
+			if strings.Contains(routerIP, ":") {
+				routerIP = "[" + routerIP + "]"
+			}
+			curl := fmt.Sprintf("curl -k -s --http2 -o /dev/null -w '%%{http_version} %%{http_code}\\n' --resolve '%s:443:%s'", host, routerIP)
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			g.By("checking that new connections negotiate HTTP/2")
+			err = waitForHTTPVersionExec(ns, execPod.Name, curl, host, "2", changeTimeoutSeconds)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By(fmt.Sprintf("holding an HTTP/2 stream open for %ds and sending a steady load", http2StreamSeconds))
+			var (
+				wg           sync.WaitGroup
+				streamOutput string
+				streamErr    error
+				loadOutput   string
+				loadErr      error
+			)
+			wg.Add(2)
+			go func() {
+				defer g.GinkgoRecover()
+				defer wg.Done()
+				cmd := fmt.Sprintf("%s -m %d 'https://%s/shell?cmd=sleep%%20%d'", curl, 2*http2StreamSeconds, host, http2StreamSeconds)
+				streamOutput, streamErr = e2e.RunHostCmd(ns, execPod.Name, cmd)
+			}()
+			go func() {
+				defer g.GinkgoRecover()
+				defer wg.Done()
+				cmd := fmt.Sprintf(`
+					rm -f /tmp/stop-load
+					STOP=$(($(date '+%%s') + %d))
+					while [ ! -f /tmp/stop-load ] && [ $(date '+%%s') -lt $STOP ]; do
+						%s -m 5 'https://%s/echo?msg=ok' || echo "error $?"
+						sleep 0.5
+					done
+					`, 10*60, curl, host)
+				loadOutput, loadErr = e2e.RunHostCmd(ns, execPod.Name, cmd)
+			}()
+			// Let the stream reach the backend before the router
+			// starts to roll out.
+			time.Sleep(5 * time.Second)
+
+			g.By("disabling HTTP/2 for the router shard while the stream is open")
+			err = setRouterShardHTTP2(oc, shardName, false)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			err = waitForRouterShardHTTP2(oc, shardName, false)
+			o.Expect(err).NotTo(o.HaveOccurred(), "router shard with HTTP/2 disabled did not rollout")
+
+			g.By("checking that new connections negotiate HTTP/1.1")
+			err = waitForHTTPVersionExec(ns, execPod.Name, curl, host, "1.1", changeTimeoutSeconds)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("waiting for the stream and the load to complete")
+			_, err = e2e.RunHostCmd(ns, execPod.Name, "touch /tmp/stop-load")
+			o.Expect(err).NotTo(o.HaveOccurred())
+			wg.Wait()
+
+			o.Expect(streamErr).NotTo(o.HaveOccurred(), "the HTTP/2 stream failed: %s", streamOutput)
+			o.Expect(strings.TrimSpace(streamOutput)).To(o.Equal("2 200"), "the HTTP/2 stream that was open during the rollout should have completed")
+
+			o.Expect(loadErr).NotTo(o.HaveOccurred(), "the load failed: %s", loadOutput)
+			versions := map[string]int{}
+			var serverErrors, connectionErrors []string
+			for _, line := range strings.Split(strings.TrimSpace(loadOutput), "\n") {
+				fields := strings.Fields(line)
+				switch {
+				case len(fields) == 2 && fields[0] == "error":
+					connectionErrors = append(connectionErrors, line)
+				case len(fields) == 2 && strings.HasPrefix(fields[1], "5"):
+					serverErrors = append(serverErrors, line)
+				case len(fields) == 2 && fields[1] != "000":
+					versions[fields[0]]++
+				}
+			}
+			e2e.Logf("load responses by HTTP version: %v; %d connection errors; %d server errors", versions, len(connectionErrors), len(serverErrors))
+			o.Expect(versions).To(o.HaveKey("2"), "the load should have used HTTP/2 before the rollout")
+			o.Expect(versions).To(o.HaveKey("1.1"), "the load should have used HTTP/1.1 after the rollout")
+			o.Expect(serverErrors).To(o.BeEmpty(), "the router returned server errors while HTTP/2 was disabled")
+		})
+	})
+})
+
+// setRouterShardHTTP2 enables or disables HTTP/2 for the router of the named
+// ingresscontroller.
+func setRouterShardHTTP2(oc *exutil.CLI, name string, enabled bool) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:"%t"}}}`, enableHTTP2Annotation, enabled)
+	_, err := oc.AdminOperatorClient().OperatorV1().IngressControllers("openshift-ingress-operator").Patch(context.Background(), name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// waitForRouterShardHTTP2 waits until the operator has updated the router
+// deployment of the named ingresscontroller for the HTTP/2 setting and the
+// update has rolled out.
+func waitForRouterShardHTTP2(oc *exutil.CLI, name string, enabled bool) error {
+	disabled := strconv.FormatBool(!enabled)
+	err := wait.PollImmediate(3*time.Second, 5*time.Minute, func() (bool, error) {
+		deployment, err := oc.AdminKubeClient().AppsV1().Deployments("openshift-ingress").Get(context.Background(), "router-"+name, metav1.GetOptions{})
+		if err != nil {
+			e2e.Logf("failed to get router deployment of ingresscontroller %s: %v, retrying...", name, err)
+			return false, nil
+		}
+		// The router enables HTTP/2 unless the variable is set.
+		value := "false"
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			for _, env := range container.Env {
+				if env.Name == "ROUTER_DISABLE_HTTP2" {
+					value = env.Value
+				}
+			}
+		}
+		return value == disabled, nil
+	})
+	if err != nil {
+		return fmt.Errorf("router deployment of ingresscontroller %s never set ROUTER_DISABLE_HTTP2=%s: %v", name, disabled, err)
+	}
+	_, err = shard.WaitForRouterShardRollout(oc, 10*time.Minute, name)
+	return err
+}
+
+// waitForHTTPVersionExec waits until curl, which must write out the HTTP
+// version and the status code, gets a successful response from host with
+// the given HTTP version.
+func waitForHTTPVersionExec(ns, execPodName, curl, host, version string, timeoutSeconds int) error {
+	cmd := fmt.Sprintf(`
+		STOP=$(($(date '+%%s') + %[1]d))
+		while [ $(date '+%%s') -lt $STOP ]; do
+			out=$( %[2]s -m 5 'https://%[3]s/echo?msg=ok' ) || true
+			echo "$out"
+			if [ "$out" = "%[4]s 200" ]; then
+				exit 0
+			fi
+			sleep 1
+		done
+		exit 1
+		`, timeoutSeconds, curl, host, version)
+	output, err := e2e.RunHostCmd(ns, execPodName, cmd)
+	if err != nil {
+		return fmt.Errorf("never got an HTTP/%s response from %s: %v\n%s", version, host, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/certgen"
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		http2ServiceConfigPath = exutil.FixturePath("testdata", "router", "router-http2.yaml")
+		http2RoutesConfigPath  = exutil.FixturePath("testdata", "router", "router-http2-routes.yaml")
+
+		oc = exutil.NewCLI("router-http2-internal")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("http2", oc)
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		// Unlike "should pass the http2 tests", this test reaches the
+		// router through its internal service from an exec pod, so it
+		// does not depend on a load balancer that supports HTTP/2.
+		g.It("should negotiate HTTP/2 end-to-end when HTTP/2 is enabled on the ingresscontroller", func() {
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			g.By("Locating the canary image reference")
+			image, err := getCanaryImage(oc)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating an ALPN-capable backend that reports the protocol of its requests")
+			err = oc.Run("new-app").Args("-f", http2ServiceConfigPath, "-p", "IMAGE="+image).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+			e2e.ExpectNoError(e2epod.WaitForPodRunningInNamespaceSlow(oc.KubeClient(), "http2", ns))
+
+			notBefore := time.Now().Add(-24 * time.Hour)
+			notAfter := time.Now().Add(24 * time.Hour)
+			_, tlsCrtData, tlsPrivateKey, err := certgen.GenerateKeyPair(notBefore, notAfter)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			derKey, err := certgen.MarshalPrivateKeyToDERFormat(tlsPrivateKey)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			pemCrt, err := certgen.MarshalCertToPEMString(tlsCrtData)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating edge, reencrypt and passthrough routes with default and custom certificates")
+			err = oc.Run("new-app").Args("-f", http2RoutesConfigPath,
+				"-p", "DOMAIN="+shardFQDN,
+				"-p", "TLS_CRT="+pemCrt,
+				"-p", "TLS_KEY="+derKey,
+				"-p", "TYPE="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating a router shard with HTTP/2 enabled")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			err = setRouterShardHTTP2(oc, shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			err = waitForRouterShardHTTP2(oc, shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred(), "router shard with HTTP/2 enabled did not rollout")
+
+			service, err := oc.AdminKubeClient().CoreV1().Services("openshift-ingress").Get(context.Background(), "router-internal-"+shardName, metav1.GetOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			routerIP := service.Spec.ClusterIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+
+			// The router only negotiates h2 for routes with a custom
+			// certificate, because clients would otherwise coalesce
+			// the connections of every route that the default
+			// wildcard certificate covers.  The backend responds with
+			// the protocol of the request it received.
+			testCases := []struct {
+				route         string
+				http2         bool
+				frontendProto string
+				backendProto  string
+			}{
+				{route: "http2-custom-cert-edge", http2: true, frontendProto: "HTTP/2.0", backendProto: "HTTP/1.1"},
+				{route: "http2-custom-cert-reencrypt", http2: true, frontendProto: "HTTP/2.0", backendProto: "HTTP/2.0"},
+				{route: "http2-passthrough", http2: true, frontendProto: "HTTP/2.0", backendProto: "HTTP/2.0"},
+				{route: "http2-default-cert-edge", http2: true, frontendProto: "HTTP/1.1", backendProto: "HTTP/1.1"},
+				{route: "http2-default-cert-reencrypt", http2: true, frontendProto: "HTTP/1.1", backendProto: "HTTP/2.0"},
+				{route: "http2-custom-cert-edge", http2: false, frontendProto: "HTTP/1.1", backendProto: "HTTP/1.1"},
+				{route: "http2-custom-cert-reencrypt", http2: false, frontendProto: "HTTP/1.1", backendProto: "HTTP/2.0"},
+				{route: "http2-passthrough", http2: false, frontendProto: "HTTP/1.1", backendProto: "HTTP/1.1"},
+			}
+			for i, tc := range testCases {
+				g.By(fmt.Sprintf("[test #%d/%d]: requesting route %s offering h2=%t", i+1, len(testCases), tc.route, tc.http2))
+				req := httpprobe.Request{
+					Scheme:  "https",
+					Host:    tc.route + "." + shardFQDN,
+					Address: routerIP,
+					HTTP2:   tc.http2,
+				}
+				resp, err := prober.WaitForStatus(req, http.StatusOK, 5*time.Minute)
+				o.Expect(err).NotTo(o.HaveOccurred(), "%+v", tc)
+				o.Expect(resp.Proto).To(o.Equal(tc.frontendProto), "%+v", tc)
+				o.Expect(string(resp.Body)).To(o.Equal(tc.backendProto), "%+v", tc)
+				if tc.frontendProto == "HTTP/2.0" {
+					o.Expect(resp.TLS.NegotiatedProtocol).To(o.Equal("h2"), "%+v", tc)
+				}
+			}
+		})
+	})
+})
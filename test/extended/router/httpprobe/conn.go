@@ -0,0 +1,136 @@
+package httpprobe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// relayCommand returns the command that the exec pod runs to relay its stdin
+// and stdout to a TCP connection to host:port.  It only needs bash, whose
+// /dev/tcp redirection accepts both IPv4 and IPv6 addresses.  The session
+// ends as soon as either direction ends: when the server closes the
+// connection, so that the client reads the end of stdout, and when the
+// client closes stdin, so that a connection that the server keeps alive
+// does not keep the exec session open.  The writer reads stdin explicitly,
+// bash gives background commands /dev/null otherwise.
+func relayCommand(host string, port int) []string {
+	script := fmt.Sprintf("exec 3<>/dev/tcp/%s/%d || exit 1; cat <&3 & r=$!; cat <&0 >&3 & w=$!; wait -n; kill $r $w 2>/dev/null", host, port)
+	return []string{"bash", "-c", script}
+}
+
+// Dial opens a TCP connection from the exec pod to host:port.  The returned
+// connection ignores deadlines, callers bound their requests with a context
+// or a client timeout, both of which close the connection.  A direct prober
+// dials from the test process instead.
+func (p *Prober) Dial(ctx context.Context, host string, port int) (net.Conn, error) {
+	if len(p.execPod) == 0 {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	url := p.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(p.namespace).
+		Name(p.execPod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Command: relayCommand(host, port),
+			Stdin:   true,
+			Stdout:  true,
+			Stderr:  true,
+		}, scheme.ParameterCodec).URL()
+	executor, err := remotecommand.NewSPDYExecutor(p.config, "POST", url)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize a new SPDY executor: %v", err)
+	}
+	stream := func(stdin io.Reader, stdout io.Writer) error {
+		var stderr bytes.Buffer
+		err := executor.Stream(remotecommand.StreamOptions{
+			Stdin:  stdin,
+			Stdout: stdout,
+			Stderr: &stderr,
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, stderr.String())
+		}
+		return nil
+	}
+	local := execAddr(fmt.Sprintf("%s/%s", p.namespace, p.execPod))
+	remote := execAddr(net.JoinHostPort(host, strconv.Itoa(port)))
+	return newExecConn(ctx, stream, local, remote), nil
+}
+
+// newExecConn returns a connection over the stdin and stdout of stream, which
+// runs the relay until it ends.  The connection is closed once ctx is done.
+func newExecConn(ctx context.Context, stream func(stdin io.Reader, stdout io.Writer) error, local, remote execAddr) *execConn {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	conn := &execConn{
+		stdin:  stdinWriter,
+		stdout: stdoutReader,
+		closed: make(chan struct{}),
+		local:  local,
+		remote: remote,
+	}
+	go func() {
+		err := stream(stdinReader, stdoutWriter)
+		if err != nil {
+			err = fmt.Errorf("relay to %s failed: %v", remote, err)
+		}
+		stdinReader.CloseWithError(err)
+		stdoutWriter.CloseWithError(err)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-conn.closed:
+		}
+	}()
+	return conn
+}
+
+// execConn is a net.Conn over the stdin and stdout of an exec session.
+type execConn struct {
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+	closed chan struct{}
+	once   sync.Once
+
+	local, remote execAddr
+}
+
+func (c *execConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *execConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Close ends the exec session: closing stdin stops the relay in the pod and
+// closing stdout fails any read that is still waiting for it.
+func (c *execConn) Close() error {
+	c.once.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *execConn) LocalAddr() net.Addr                { return c.local }
+func (c *execConn) RemoteAddr() net.Addr               { return c.remote }
+func (c *execConn) SetDeadline(t time.Time) error      { return nil }
+func (c *execConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *execConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// execAddr is the address of either end of an execConn.
+type execAddr string
+
+func (a execAddr) Network() string { return "exec" }
+func (a execAddr) String() string  { return string(a) }
@@ -0,0 +1,154 @@
+package httpprobe
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// startRelay runs the relay command of the exec pod locally against a new
+// listener, and returns the listener, the relay and its stdin and stdout.
+func startRelay(t *testing.T) (net.Listener, *exec.Cmd, io.WriteCloser, io.Reader) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("the relay needs bash")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	args := relayCommand("127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	cmd := exec.Command(args[0], args[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return listener, cmd, stdin, stdout
+}
+
+func TestRelayEndsWhenServerCloses(t *testing.T) {
+	listener, _, stdin, stdout := startRelay(t)
+	defer stdin.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdin.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil || string(request) != "ping" {
+		t.Fatalf("expected the server to read ping, got %q: %v", request, err)
+	}
+	conn.Write([]byte("pong"))
+	conn.Close()
+
+	// stdin stays open, as it does while a client reads the response.
+	read := make(chan string)
+	go func() {
+		body, _ := ioutil.ReadAll(stdout)
+		read <- string(body)
+	}()
+	select {
+	case body := <-read:
+		if body != "pong" {
+			t.Errorf("expected the client to read pong, got %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stdout did not end after the server closed the connection")
+	}
+}
+
+func TestRelayEndsWhenClientCloses(t *testing.T) {
+	listener, cmd, stdin, _ := startRelay(t)
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The server keeps the connection open.
+	stdin.Close()
+	done := make(chan error)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the relay did not exit after the client closed stdin")
+	}
+}
+
+// localStream runs the relay command locally, in place of an exec session.
+func localStream(args []string) func(stdin io.Reader, stdout io.Writer) error {
+	return func(stdin io.Reader, stdout io.Writer) error {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmdStdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		cmdStdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		go func() {
+			io.Copy(cmdStdin, stdin)
+			cmdStdin.Close()
+		}()
+		io.Copy(stdout, cmdStdout)
+		return cmd.Wait()
+	}
+}
+
+// TestTimeToCloseThroughRelay checks that the time until the server closes
+// a connection is measured through the exec relay, as the timeout tests of
+// the router rely on.
+func TestTimeToCloseThroughRelay(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("the relay needs bash")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	const serverTimeout = time.Second
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		time.Sleep(serverTimeout)
+		conn.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	port := listener.Addr().(*net.TCPAddr).Port
+	conn := newExecConn(ctx, localStream(relayCommand("127.0.0.1", port)), "local", execAddr(listener.Addr().String()))
+	defer conn.Close()
+	elapsed, err := timeToClose(ctx, conn, []byte("GET / HTTP/1.1\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed < serverTimeout/2 || elapsed > 3*serverTimeout {
+		t.Errorf("expected the connection to close after about %s, got %s", serverTimeout, elapsed)
+	}
+}
@@ -0,0 +1,269 @@
+// Package httpprobe makes HTTP requests to routers from inside the cluster.
+// Each connection is relayed through an exec pod, so that tests can use Go's
+// HTTP client, with a custom Host header and SNI, client certificates and
+// HTTP/2, against router addresses that are only reachable from the cluster
+// network, and assert on the status, headers and body of the responses.
+//
+// A prober returned by NewDirect connects from the test process instead, for
+// routers that are published on an address that is reachable from outside the
+// cluster, like the load balancer of the default ingresscontroller.
+package httpprobe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+)
+
+// DefaultTimeout bounds a request whose Timeout is zero.
+const DefaultTimeout = 30 * time.Second
+
+// Prober makes requests from an exec pod, or from the test process if it has
+// no exec pod.  The pod's image must have bash.
+type Prober struct {
+	client    kubernetes.Interface
+	config    *rest.Config
+	namespace string
+	execPod   string
+}
+
+// New returns a prober that relays its connections through execPod in
+// namespace.
+func New(client kubernetes.Interface, config *rest.Config, namespace, execPod string) *Prober {
+	return &Prober{
+		client:    client,
+		config:    config,
+		namespace: namespace,
+		execPod:   execPod,
+	}
+}
+
+// NewDirect returns a prober that connects from the test process.
+func NewDirect() *Prober {
+	return &Prober{}
+}
+
+// Request describes a request to a route through a router.
+type Request struct {
+	// Method defaults to GET.
+	Method string
+	// Scheme is http or https, and defaults to http.
+	Scheme string
+	// Host is the host of the route.  It is sent as the Host header and,
+	// unless ServerName is set, as the SNI server name.
+	Host string
+	// Path defaults to /.
+	Path string
+	// Address is the IP address or host name of the router to connect to
+	// instead of resolving Host.
+	Address string
+	// Port defaults to 80 for http and 443 for https.
+	Port int
+
+	// Header is sent as is.  In particular, Accept-Encoding is only sent
+	// if it is set here, and compressed responses are returned with their
+	// compressed body.
+	Header http.Header
+	Body   []byte
+
+	// ServerName overrides the SNI server name.
+	ServerName string
+	// Certificates are presented to routers that request a client
+	// certificate.
+	Certificates []tls.Certificate
+	// RootCAs verifies the router's certificate.  If nil, the certificate
+	// is not verified.
+	RootCAs *x509.CertPool
+	// MinVersion and MaxVersion restrict the TLS versions that are offered.
+	MinVersion, MaxVersion uint16
+	// CipherSuites restricts the TLS 1.2 and earlier cipher suites that
+	// are offered.  The TLS 1.3 cipher suites are not configurable.
+	CipherSuites []uint16
+
+	// HTTP2 offers h2 with ALPN on https, and uses HTTP/2 with prior
+	// knowledge (h2c) on http.
+	HTTP2 bool
+
+	// Timeout bounds the whole request, it defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// URL returns the URL of the request.
+func (r Request) URL() string {
+	path := r.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+	return fmt.Sprintf("%s://%s%s", r.scheme(), net.JoinHostPort(r.Host, strconv.Itoa(r.port())), path)
+}
+
+func (r Request) scheme() string {
+	if len(r.Scheme) == 0 {
+		return "http"
+	}
+	return r.Scheme
+}
+
+func (r Request) port() int {
+	switch {
+	case r.Port != 0:
+		return r.Port
+	case r.scheme() == "https":
+		return 443
+	default:
+		return 80
+	}
+}
+
+// Response is a response that was read to the end.
+type Response struct {
+	StatusCode int
+	// Proto is the protocol that the router answered with, like HTTP/1.1
+	// or HTTP/2.0.
+	Proto  string
+	Header http.Header
+	Body   []byte
+	// TLS is the state of the connection on https, and nil on http.
+	TLS *tls.ConnectionState
+}
+
+// Do makes a single request.  Redirects are not followed, the redirect
+// response is returned instead.
+func (p *Prober) Do(req Request) (*Response, error) {
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	method := req.Method
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL(), bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.Header {
+		httpReq.Header[name] = values
+	}
+
+	transport := p.transport(req)
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response from %s: %v", req.URL(), err)
+	}
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     resp.Header,
+		Body:       body,
+		TLS:        resp.TLS,
+	}, nil
+}
+
+// transport returns a transport that connects to the router of req instead
+// of the address that the request URL resolves to.
+func (p *Prober) transport(req Request) http.RoundTripper {
+	address := req.Address
+	if len(address) == 0 {
+		address = req.Host
+	}
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return p.Dial(ctx, address, req.port())
+	}
+
+	if req.HTTP2 && req.scheme() == "http" {
+		return &http2.Transport{
+			AllowHTTP:          true,
+			DisableCompression: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(context.Background(), network, addr)
+			},
+		}
+	}
+	return &http.Transport{
+		DialContext:        dial,
+		TLSClientConfig:    req.tlsConfig(),
+		ForceAttemptHTTP2:  req.HTTP2,
+		DisableKeepAlives:  true,
+		DisableCompression: true,
+	}
+}
+
+// tlsConfig returns the client TLS configuration of req.
+func (r Request) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         r.ServerName,
+		Certificates:       r.Certificates,
+		RootCAs:            r.RootCAs,
+		InsecureSkipVerify: r.RootCAs == nil,
+		MinVersion:         r.MinVersion,
+		MaxVersion:         r.MaxVersion,
+		CipherSuites:       r.CipherSuites,
+	}
+}
+
+// WaitFor repeats req until done accepts a response, done returns an error,
+// or timeout expires, and returns the last response.  Failed requests are
+// retried.  The attempts are jittered so that parallel tests that probe the
+// same router do not do so in lockstep.
+func (p *Prober) WaitFor(req Request, timeout time.Duration, done func(*Response) (bool, error)) (*Response, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := p.Do(req)
+		if err != nil {
+			e2e.Logf("request to %s failed: %v", req.URL(), err)
+		} else {
+			ok, err := done(resp)
+			if err != nil {
+				return resp, err
+			}
+			if ok {
+				return resp, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return resp, fmt.Errorf("timed out waiting for %s: %v", req.URL(), err)
+			}
+			return resp, fmt.Errorf("timed out waiting for %s, last status %d", req.URL(), resp.StatusCode)
+		}
+		time.Sleep(wait.Jitter(time.Second, 1.0))
+	}
+}
+
+// WaitForStatus is WaitFor, accepting the first response with status.
+func (p *Prober) WaitForStatus(req Request, status int, timeout time.Duration) (*Response, error) {
+	return p.WaitFor(req, timeout, func(resp *Response) (bool, error) {
+		return resp.StatusCode == status, nil
+	})
+}
@@ -0,0 +1,59 @@
+package httpprobe_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+)
+
+func TestRequestURL(t *testing.T) {
+	for _, tc := range []struct {
+		req  httpprobe.Request
+		want string
+	}{
+		{httpprobe.Request{Host: "insecure.example.test"}, "http://insecure.example.test:80/"},
+		{httpprobe.Request{Scheme: "https", Host: "edge.example.test", Path: "/path"}, "https://edge.example.test:443/path"},
+		{httpprobe.Request{Scheme: "https", Host: "edge.example.test", Port: 8443}, "https://edge.example.test:8443/"},
+		{httpprobe.Request{Host: "fd00::1"}, "http://[fd00::1]:80/"},
+	} {
+		if got := tc.req.URL(); got != tc.want {
+			t.Errorf("expected %s, got %s", tc.want, got)
+		}
+	}
+}
+
+func TestDirectProber(t *testing.T) {
+	var host, serverName string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		serverName = r.TLS.ServerName
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	resp, err := httpprobe.NewDirect().Do(httpprobe.Request{
+		Scheme:     "https",
+		Host:       "route.example.test",
+		ServerName: "sni.example.test",
+		Address:    addr.IP.String(),
+		Port:       addr.Port,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != "ok" {
+		t.Errorf("expected 200 ok, got %d %q", resp.StatusCode, resp.Body)
+	}
+	if want := net.JoinHostPort("route.example.test", strconv.Itoa(addr.Port)); host != want {
+		t.Errorf("expected Host %s, got %s", want, host)
+	}
+	if serverName != "sni.example.test" {
+		t.Errorf("expected SNI sni.example.test, got %s", serverName)
+	}
+}
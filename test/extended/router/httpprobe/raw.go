@@ -0,0 +1,151 @@
+package httpprobe
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+)
+
+// DoRaw writes raw to a new connection to the router of req, and returns the
+// responses that the router sends until it closes the connection.  raw is
+// sent as is, so that tests can send requests that Go's HTTP client refuses
+// to, like requests with conflicting framing headers.  Of req, only the
+// connection and TLS fields are used.  Requests in raw should ask the router
+// to close the connection, or the responses are only returned once
+// req.Timeout expires.
+func (p *Prober) DoRaw(req Request, raw []byte) ([]*Response, error) {
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, state, err := p.dialRaw(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// The router may answer and close the connection before it has read
+	// all of raw, so a failed write is only an error without a response.
+	_, writeErr := conn.Write(raw)
+	responses, err := ReadResponses(conn)
+	for _, resp := range responses {
+		resp.TLS = state
+	}
+	if len(responses) == 0 {
+		if writeErr != nil {
+			return nil, fmt.Errorf("failed to write the request to %s: %v", conn.RemoteAddr(), writeErr)
+		}
+		return nil, fmt.Errorf("no response from %s: %v", conn.RemoteAddr(), err)
+	}
+	return responses, nil
+}
+
+// TimeToClose writes raw, which may be empty, to a new connection to the
+// router of req, reads until the router closes the connection, and returns
+// how long the connection stayed open after raw was written.  On https, the
+// TLS handshake completes before raw is written.  It fails if the connection
+// is still open when req.Timeout expires.
+func (p *Prober) TimeToClose(req Request, raw []byte) (time.Duration, error) {
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, _, err := p.dialRaw(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return timeToClose(ctx, conn, raw)
+}
+
+// timeToClose is TimeToClose on conn, which is closed once ctx is done.
+func timeToClose(ctx context.Context, conn net.Conn, raw []byte) (time.Duration, error) {
+	if len(raw) > 0 {
+		if _, err := conn.Write(raw); err != nil {
+			return 0, fmt.Errorf("failed to write to %s: %v", conn.RemoteAddr(), err)
+		}
+	}
+	start := time.Now()
+	_, err := io.Copy(ioutil.Discard, conn)
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		return elapsed, fmt.Errorf("the connection to %s was still open after %s", conn.RemoteAddr(), elapsed)
+	}
+	// A reset or a TLS alert also closes the connection.
+	if err != nil {
+		e2e.Logf("the connection to %s ended with %v after %s", conn.RemoteAddr(), err, elapsed)
+	}
+	return elapsed, nil
+}
+
+// dialRaw opens a connection to the router of req, and completes the TLS
+// handshake on https.
+func (p *Prober) dialRaw(ctx context.Context, req Request) (net.Conn, *tls.ConnectionState, error) {
+	address := req.Address
+	if len(address) == 0 {
+		address = req.Host
+	}
+	conn, err := p.Dial(ctx, address, req.port())
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.scheme() != "https" {
+		return conn, nil, nil
+	}
+	config := req.tlsConfig()
+	if len(config.ServerName) == 0 {
+		config.ServerName = req.Host
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("TLS handshake with %s failed: %v", address, err)
+	}
+	state := tlsConn.ConnectionState()
+	return tlsConn, &state, nil
+}
+
+// ReadResponses reads responses from r until it ends, and returns the
+// responses that were read completely with the error that ended them, or nil
+// if r ended cleanly between two responses.
+func ReadResponses(r io.Reader) ([]*Response, error) {
+	var responses []*Response
+	br := bufio.NewReader(r)
+	for {
+		if _, err := br.Peek(1); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return responses, err
+		}
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return responses, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, &Response{
+			StatusCode: resp.StatusCode,
+			Proto:      resp.Proto,
+			Header:     resp.Header,
+			Body:       body,
+		})
+	}
+}
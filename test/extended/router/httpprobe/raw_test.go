@@ -0,0 +1,66 @@
+package httpprobe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+)
+
+func TestReadResponses(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		stream  string
+		want    []int
+		wantErr bool
+	}{
+		{
+			name:   "one response",
+			stream: "HTTP/1.1 400 Bad Request\r\nContent-Length: 3\r\nConnection: close\r\n\r\nbad",
+			want:   []int{400},
+		},
+		{
+			name:   "two responses",
+			stream: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nokHTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n",
+			want:   []int{200, 404},
+		},
+		{
+			name:   "response until close",
+			stream: "HTTP/1.0 200 OK\r\n\r\nGET / HTTP/1.1\r\n",
+			want:   []int{200},
+		},
+		{
+			name:    "truncated response",
+			stream:  "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nokHTTP/1.1 502",
+			want:    []int{200},
+			wantErr: true,
+		},
+		{
+			name:   "nothing",
+			stream: "",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			responses, err := httpprobe.ReadResponses(strings.NewReader(tc.stream))
+			if tc.wantErr != (err != nil) {
+				t.Errorf("unexpected error %v", err)
+			}
+			var got []int
+			for _, resp := range responses {
+				got = append(got, resp.StatusCode)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected statuses %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("expected statuses %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+	responses, err := httpprobe.ReadResponses(strings.NewReader("HTTP/1.0 200 OK\r\n\r\nGET / HTTP/1.1\r\n"))
+	if err != nil || string(responses[0].Body) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("expected the body to be read until close, got %v, %v", responses, err)
+	}
+}
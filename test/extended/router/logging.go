@@ -0,0 +1,263 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2edeployment "k8s.io/kubernetes/test/e2e/framework/deployment"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+// routerLogEvent is a message that the router logs for an event, optionally
+// together with a value, like the name of a route, on the same line.
+type routerLogEvent struct {
+	message string
+	value   string
+}
+
+func (e routerLogEvent) String() string {
+	if len(e.value) == 0 {
+		return fmt.Sprintf("%q", e.message)
+	}
+	return fmt.Sprintf("%q with %q", e.message, e.value)
+}
+
+func (e routerLogEvent) matches(line string) bool {
+	return strings.Contains(line, e.message) && strings.Contains(line, e.value)
+}
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		routerImage string
+		ns          string
+		oc          *exutil.CLI
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("router-", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-logging")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("logs route admission, config writes and reloads at the configured log level", func() {
+			g.By("deploying a namespace scoped router with the default log level")
+			deployment, err := oc.AdminKubeClient().AppsV1().Deployments(ns).Create(context.Background(), loggingRouter(routerImage, ns), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			err = e2edeployment.WaitForDeploymentComplete(oc.AdminKubeClient(), deployment)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			createRoute := func(name string) {
+				_, err := client.Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{Name: name},
+					Spec: routev1.RouteSpec{
+						To:   routev1.RouteTargetReference{Name: "logging"},
+						Port: &routev1.RoutePort{TargetPort: intstr.FromInt(8080)},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				err = wait.PollImmediate(time.Second, 2*time.Minute, func() (bool, error) {
+					route, err := client.Get(context.Background(), name, metav1.GetOptions{})
+					if err != nil {
+						return false, err
+					}
+					ingress := findIngress(route, "logging")
+					return ingress != nil && len(ingress.Conditions) > 0 && ingress.Conditions[0].Type == routev1.RouteAdmitted && ingress.Conditions[0].Status == corev1.ConditionTrue, nil
+				})
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %s was not admitted", name)
+			}
+
+			reloaded := routerLogEvent{message: "router reloaded"}
+			writing := routerLogEvent{message: "writing the router config"}
+
+			g.By("checking that the router only logs reloads at the default log level")
+			createRoute("quiet")
+			err = waitForRouterLogEvents(oc.AdminKubeClient(), deployment, reloaded)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			found, err := routerLogContains(oc.AdminKubeClient(), deployment, writing)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(found).To(o.BeFalse(), "the router logged %s at the default log level", writing)
+
+			g.By("raising the log level of the router")
+			deployment, err = setRouterLogLevel(oc.AdminKubeClient(), ns, deployment.Name, 4)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("checking that the router logs the admission, config write and reload for a new route")
+			createRoute("verbose")
+			err = waitForRouterLogEvents(oc.AdminKubeClient(), deployment,
+				routerLogEvent{message: "admitting route by updating status", value: "verbose"},
+				writing,
+				reloaded,
+			)
+			o.Expect(err).NotTo(o.HaveOccurred())
+		})
+	})
+})
+
+func loggingRouter(image, ns string) *appsv1.Deployment {
+	one := int64(1)
+	replicas := int32(1)
+	labels := map[string]string{"app": "router-logging"}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "router-logging",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: &one,
+					Containers: []corev1.Container{
+						{
+							Name:  "router",
+							Image: image,
+							Args: []string{
+								"-v=0",
+								fmt.Sprintf("--namespace=%s", ns),
+								"--name=logging",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// setRouterLogLevel changes the -v argument of the router container of a
+// deployment and waits for the new router pods to roll out.
+func setRouterLogLevel(c clientset.Interface, ns, name string, level int) (*appsv1.Deployment, error) {
+	deployment, err := e2edeployment.UpdateDeploymentWithRetries(c, ns, name, func(d *appsv1.Deployment) {
+		for i := range d.Spec.Template.Spec.Containers {
+			container := &d.Spec.Template.Spec.Containers[i]
+			if container.Name != "router" {
+				continue
+			}
+			var args []string
+			for _, arg := range container.Args {
+				if !strings.HasPrefix(arg, "-v=") && !strings.HasPrefix(arg, "--v=") {
+					args = append(args, arg)
+				}
+			}
+			container.Args = append(args, fmt.Sprintf("-v=%d", level))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := e2edeployment.WaitForDeploymentComplete(c, deployment); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+// routerLogs returns the logs of the router containers of the current pods
+// of a deployment.
+func routerLogs(c clientset.Interface, deployment *appsv1.Deployment) (string, error) {
+	pods, err := e2edeployment.GetPodsForDeployment(c, deployment)
+	if err != nil {
+		return "", err
+	}
+	var logs []string
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		data, err := c.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: "router"}).DoRaw(context.Background())
+		if err != nil {
+			return "", err
+		}
+		logs = append(logs, string(data))
+	}
+	return strings.Join(logs, "\n"), nil
+}
+
+// routerLogContains returns whether a line of the router logs matches event.
+func routerLogContains(c clientset.Interface, deployment *appsv1.Deployment, event routerLogEvent) (bool, error) {
+	logs, err := routerLogs(c, deployment)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(logs, "\n") {
+		if event.matches(line) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// waitForRouterLogEvents waits until the router logs contain all events.
+func waitForRouterLogEvents(c clientset.Interface, deployment *appsv1.Deployment, events ...routerLogEvent) error {
+	var missing []string
+	err := wait.PollImmediate(2*time.Second, 2*time.Minute, func() (bool, error) {
+		missing = nil
+		for _, event := range events {
+			found, err := routerLogContains(c, deployment, event)
+			if err != nil {
+				e2e.Logf("unable to read the router logs: %v", err)
+				return false, nil
+			}
+			if !found {
+				missing = append(missing, event.String())
+			}
+		}
+		return len(missing) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		err = fmt.Errorf("the router did not log %s", strings.Join(missing, ", "))
+	}
+	return err
+}
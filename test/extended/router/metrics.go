@@ -29,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 
+	"github.com/openshift/origin/test/extended/router/routerstats"
 	exutil "github.com/openshift/origin/test/extended/util"
 
 	configv1 "github.com/openshift/api/config/v1"
@@ -80,9 +81,8 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 		host = subset.Addresses[0].IP
 
 		// Extract the router pod's stats credentials.
-		statsSecret, err := oc.AdminKubeClient().CoreV1().Secrets("openshift-ingress").Get(context.Background(), "router-stats-default", metav1.GetOptions{})
+		username, password, err = routerstats.Credentials(oc.AdminKubeClient(), "default")
 		o.Expect(err).NotTo(o.HaveOccurred())
-		username, password = string(statsSecret.Data["statsUsername"]), string(statsSecret.Data["statsPassword"])
 
 		token, err := oc.AdminKubeClient().
 			CoreV1().
@@ -0,0 +1,393 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	t "github.com/onsi/ginkgo/extensions/table"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/certgen"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+	"github.com/openshift/origin/test/extended/util/certs"
+	"github.com/openshift/origin/test/extended/util/image"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		configPath = exutil.FixturePath("testdata", "router", "router-mtls.yaml")
+		oc         *exutil.CLI
+		ns         string
+
+		shardName    string // computed
+		clientCAName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("router-", oc)
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+		if len(clientCAName) > 0 {
+			if err := oc.AdminKubeClient().CoreV1().ConfigMaps("openshift-config").Delete(context.Background(), clientCAName, metav1.DeleteOptions{}); err != nil {
+				e2e.Logf("deleting client CA configmap failed: %v\n", err)
+			}
+			clientCAName = ""
+		}
+	})
+
+	oc = exutil.NewCLI("router-mtls")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should pass the verified client certificate to the backend in X-SSL headers that clients cannot spoof", func() {
+			routerImage, err := exutil.FindRouterImage(oc)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			defaultCertificate, err := certs.NewDefaultCertificate("*.example.com")
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// certificate start and end time are very
+			// lenient to avoid any clock drift between
+			// the test machine and the cluster under
+			// test.
+			notBefore := time.Now().Add(-24 * time.Hour)
+			notAfter := time.Now().Add(24 * time.Hour)
+			commonName := "mtls-client"
+			caDER, clientDER, clientKey, err := certgen.GenerateClientKeyPair(notBefore, notAfter, commonName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			caPEM, err := certgen.MarshalCertToPEMString(caDER)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			clientPEM, err := certgen.MarshalCertToPEMString(clientDER)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			keyPEM, err := certgen.MarshalPrivateKeyToDERFormat(clientKey)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By(fmt.Sprintf("creating a router that requires client certificates from a config file %q", configPath))
+			err = oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage, "-p", "DEFAULT_CERTIFICATE="+defaultCertificate, "-p", "CLIENT_CA="+caPEM).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			var routerIP string
+			err = wait.Poll(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+				pod, err := oc.KubeFramework().ClientSet.CoreV1().Pods(ns).Get(context.Background(), "router-mtls", metav1.GetOptions{})
+				if err != nil {
+					return false, err
+				}
+				routerIP = pod.Status.PodIP
+				podIsReady := podConditionStatus(pod, corev1.PodReady)
+
+				return len(routerIP) != 0 && podIsReady == corev1.ConditionTrue, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("waiting for the healthz endpoint to respond")
+			healthzURI := fmt.Sprintf("http://%s/healthz", net.JoinHostPort(routerIP, "1936"))
+			err = waitForRouterOKResponseExec(ns, execPod.Name, healthzURI, routerIP, changeTimeoutSeconds)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			host := "mtls.example.com"
+			g.By("waiting for the route to respond to a client with a certificate")
+			err = wait.PollImmediate(2*time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+				_, err := getMutualTLSPayloadExec(ns, execPod.Name, routerIP, host, clientPEM, keyPEM, nil)
+				if err != nil {
+					e2e.Logf("route %s does not respond yet: %v", host, err)
+					return false, nil
+				}
+				return true, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("checking that a client without a certificate is rejected")
+			_, err = getMutualTLSPayloadExec(ns, execPod.Name, routerIP, host, "", "", nil)
+			o.Expect(err).To(o.HaveOccurred())
+
+			sha := sha1.Sum(clientDER)
+			expected := map[string]string{
+				"X-SSL-Client-Verify": "0",
+				"X-SSL-Client-CN":     commonName,
+				"X-SSL-Client-SHA1":   strings.ToUpper(hex.EncodeToString(sha[:])),
+				"X-SSL-Client-DER":    base64.StdEncoding.EncodeToString(clientDER),
+			}
+			spoofed := map[string]string{}
+			for _, name := range []string{"X-SSL", "X-SSL-Client-Verify", "X-SSL-Client-SHA1", "X-SSL-Client-DN", "X-SSL-Client-CN", "X-SSL-Issuer", "X-SSL-Client-DER"} {
+				spoofed[name] = "spoofed"
+			}
+			for _, tc := range []struct {
+				name    string
+				headers map[string]string
+			}{
+				{name: "a client certificate", headers: nil},
+				{name: "a client certificate and spoofed X-SSL headers", headers: spoofed},
+			} {
+				g.By(fmt.Sprintf("inspecting the headers that the backend receives for a request with %s", tc.name))
+				payload, err := getMutualTLSPayloadExec(ns, execPod.Name, routerIP, host, clientPEM, keyPEM, tc.headers)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				// The trailing \n is being stripped, so add it back
+				req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(payload + "\n")))
+				o.Expect(err).NotTo(o.HaveOccurred())
+
+				value := func(name string) string {
+					values := req.Header.Values(name)
+					o.Expect(values).To(o.HaveLen(1), "expected exactly one %s header; all headers: %#v", name, req.Header)
+					// haproxy quotes most of the values
+					return strings.Trim(values[0], `"`)
+				}
+				for name, want := range expected {
+					o.Expect(value(name)).To(o.Equal(want), "unexpected %s header; all headers: %#v", name, req.Header)
+				}
+				o.Expect(value("X-SSL-Client-DN")).To(o.ContainSubstring("CN="+commonName), "all headers: %#v", req.Header)
+				o.Expect(value("X-SSL-Issuer")).To(o.ContainSubstring("CN=Root CA"), "all headers: %#v", req.Header)
+				for name := range spoofed {
+					o.Expect(req.Header.Values(name)).NotTo(o.ContainElement("spoofed"), "the router forwarded the client's %s header", name)
+				}
+			}
+		})
+
+		t.DescribeTable("should authenticate clients with the client CA of the ingresscontroller", func(policy operatorv1.ClientCertificatePolicy) {
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			notBefore := time.Now().Add(-24 * time.Hour)
+			notAfter := time.Now().Add(24 * time.Hour)
+			commonName := "mtls-client"
+			caDER, clientDER, clientKey, err := certgen.GenerateClientKeyPair(notBefore, notAfter, commonName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			caPEM, err := certgen.MarshalCertToPEMString(caDER)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			clientPEM, err := certgen.MarshalCertToPEMString(clientDER)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			keyPEM, err := certgen.MarshalPrivateKeyToDERFormat(clientKey)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// A certificate for the same name from another CA.
+			_, otherDER, otherKey, err := certgen.GenerateClientKeyPair(notBefore, notAfter, commonName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			otherPEM, err := certgen.MarshalCertToPEMString(otherDER)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			otherKeyPEM, err := certgen.MarshalPrivateKeyToDERFormat(otherKey)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("creating the client CA configmap in openshift-config")
+			cm, err := oc.AdminKubeClient().CoreV1().ConfigMaps("openshift-config").Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ns + "-client-ca",
+				},
+				Data: map[string]string{"ca-bundle.pem": caPEM},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			clientCAName = cm.Name
+
+			g.By("creating a backend that echoes the request headers and an edge route to it")
+			createHeaderEchoBackend(oc.KubeClient(), ns, "mtls-echo")
+			host := "mtls." + shardFQDN
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			_, err = routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "mtls-echo",
+				},
+				Spec: routev1.RouteSpec{
+					Host: host,
+					To:   routev1.RouteTargetReference{Name: "mtls-echo"},
+					Port: &routev1.RoutePort{
+						TargetPort: intstr.FromInt(8676),
+					},
+					TLS: &routev1.TLSConfig{
+						Termination: routev1.TLSTerminationEdge,
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By(fmt.Sprintf("creating a router shard with the %s client certificate policy", policy))
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.ClientTLS = operatorv1.ClientTLS{
+					ClientCertificatePolicy: policy,
+					ClientCA:                configv1.ConfigMapNameReference{Name: clientCAName},
+				}
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			_, err = waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, "mtls-echo", shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerIP := routerPods[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			g.By("waiting for the route to respond to a client with a certificate")
+			var payload string
+			err = wait.PollImmediate(2*time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+				payload, err = getMutualTLSPayloadExec(ns, execPod.Name, routerIP, host, clientPEM, keyPEM, nil)
+				if err != nil {
+					e2e.Logf("route %s does not respond yet: %v", host, err)
+					return false, nil
+				}
+				return true, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("checking that the backend receives the verified client certificate")
+			// The trailing \n is being stripped, so add it back
+			req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(payload + "\n")))
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(strings.Trim(req.Header.Get("X-SSL-Client-Verify"), `"`)).To(o.Equal("0"), "all headers: %#v", req.Header)
+			o.Expect(strings.Trim(req.Header.Get("X-SSL-Client-CN"), `"`)).To(o.Equal(commonName), "all headers: %#v", req.Header)
+			o.Expect(strings.Trim(req.Header.Get("X-SSL-Client-DER"), `"`)).To(o.Equal(base64.StdEncoding.EncodeToString(clientDER)), "all headers: %#v", req.Header)
+
+			g.By("checking that a client with a certificate from another CA is rejected")
+			_, err = getMutualTLSPayloadExec(ns, execPod.Name, routerIP, host, otherPEM, otherKeyPEM, nil)
+			o.Expect(err).To(o.HaveOccurred())
+
+			_, err = getMutualTLSPayloadExec(ns, execPod.Name, routerIP, host, "", "", nil)
+			if policy == operatorv1.ClientCertificatePolicyRequired {
+				g.By("checking that a client without a certificate is rejected")
+				o.Expect(err).To(o.HaveOccurred())
+			} else {
+				g.By("checking that a client without a certificate is served")
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+		},
+			t.Entry("required", operatorv1.ClientCertificatePolicyRequired),
+			t.Entry("optional", operatorv1.ClientCertificatePolicyOptional),
+		)
+	})
+})
+
+// createHeaderEchoBackend creates a pod that responds to every request with
+// the request line and headers it received, and a service of the same name
+// in namespace ns that exposes it on port 8676.
+func createHeaderEchoBackend(client clientset.Interface, ns, name string) {
+	podLabels := map[string]string{"app": name}
+	_, err := client.CoreV1().Pods(ns).Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: podLabels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "echo",
+					Image: image.ShellImage(),
+					Command: []string{
+						"/usr/bin/socat",
+						"TCP4-LISTEN:8676,reuseaddr,fork",
+						`EXEC:'/bin/bash -c \"printf \\\"HTTP/1.0 200 OK\r\n\r\n\\\"; sed -e \\\"/^\r/q\\\"\"'`,
+					},
+					Ports: []corev1.ContainerPort{{ContainerPort: 8676}},
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+	e2e.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(client, name, ns))
+
+	_, err = client.CoreV1().Services(ns).Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: podLabels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "echo",
+					Port:       8676,
+					TargetPort: intstr.FromInt(8676),
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+}
+
+// getMutualTLSPayloadExec requests https://host/ from the router at routerIP
+// with the given client certificate, key, and extra headers, and returns the
+// response body.  No client certificate is sent if cert is empty.
+func getMutualTLSPayloadExec(ns, execPodName, routerIP, host, cert, key string, headers map[string]string) (string, error) {
+	args := []string{"-k", "-s", "-S", "-f", "-m", "10", "--resolve", fmt.Sprintf("%s:443:%s", host, routerIP)}
+	if len(cert) > 0 {
+		args = append(args, "--cert", "/tmp/client.crt", "--key", "/tmp/client.key")
+	}
+	for name, value := range headers {
+		args = append(args, "--header", fmt.Sprintf("'%s: %s'", name, value))
+	}
+	cmd := fmt.Sprintf(`
+		set -e
+		cat > /tmp/client.crt <<'EOF'
+%s
+EOF
+		cat > /tmp/client.key <<'EOF'
+%s
+EOF
+		curl %s %q
+		`, cert, key, strings.Join(args, " "), fmt.Sprintf("https://%s/", host))
+	output, err := e2e.RunHostCmd(ns, execPodName, cmd)
+	if err != nil {
+		return "", fmt.Errorf("host command failed: %v\n%s", err, output)
+	}
+	return output, nil
+}
@@ -0,0 +1,233 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	exutil "github.com/openshift/origin/test/extended/util"
+	"github.com/openshift/origin/test/extended/util/image"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc          *exutil.CLI
+		ns          string
+		routerImage string
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			exutil.DumpPodLogsStartingWith("router-", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-node-probe")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should serve a route to clients on every schedulable node", func() {
+			g.By("creating a backend")
+			createNetexecBackend(oc.KubeClient(), ns, "node-probe")
+
+			g.By("deploying a router")
+			rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter("router-node-probe", routerImage, "select=node-probe"), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+			pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=router-node-probe"})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(pods.Items).To(o.HaveLen(1))
+			routerURL := fmt.Sprintf("http://%s/echo?msg=ok", net.JoinHostPort(pods.Items[0].Status.PodIP, "80"))
+
+			host := "node-probe.example.com"
+			_, err = routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns).Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "node-probe",
+					Labels: map[string]string{"select": "node-probe"},
+				},
+				Spec: routev1.RouteSpec{
+					Host: host,
+					To:   routev1.RouteTargetReference{Name: "node-probe"},
+					Port: &routev1.RoutePort{
+						TargetPort: intstr.FromInt(8080),
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("starting a probe pod on every schedulable node")
+			probes, err := createNodeProbes(oc.AdminKubeClient(), ns, "node-probe")
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By(fmt.Sprintf("checking the route from %d nodes", len(probes.pods)))
+			results := probes.run(func(execPodName string) error {
+				return waitForRouterOKResponseExec(ns, execPodName, routerURL, host, changeTimeoutSeconds)
+			})
+			for node, err := range results {
+				e2e.Logf("route check from node %s: %v", node, err)
+			}
+			o.Expect(nodeProbeFailures(results)).NotTo(o.HaveOccurred())
+		})
+	})
+})
+
+// nodeProbes are the exec pods of a DaemonSet that runs on every schedulable
+// node, which allows running the same route check from every node to find
+// networking issues that are local to a node.
+type nodeProbes struct {
+	// pods maps the names of the nodes to the names of the exec pods
+	// that run on them.
+	pods map[string]string
+}
+
+// createNodeProbes creates a DaemonSet named name of exec pods in namespace
+// ns and waits for a ready pod on every node that the DaemonSet is
+// scheduled to.
+func createNodeProbes(client clientset.Interface, ns, name string) (*nodeProbes, error) {
+	one := int64(1)
+	podLabels := map[string]string{"app": name}
+	ds, err := client.AppsV1().DaemonSets(ns).Create(context.Background(), &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: podLabels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: podLabels,
+				},
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: &one,
+					NodeSelector:                  map[string]string{"kubernetes.io/os": "linux"},
+					SecurityContext:               e2epod.GetRestrictedPodSecurityContext(),
+					Containers: []corev1.Container{
+						{
+							Name:            "probe",
+							Image:           image.ShellImage(),
+							Command:         []string{"sh", "-c", "trap exit TERM; while true; do sleep 5; done"},
+							SecurityContext: e2epod.GetRestrictedContainerSecurityContext(),
+						},
+					},
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = wait.PollImmediate(3*time.Second, 3*time.Minute, func() (bool, error) {
+		ds, err = client.AppsV1().DaemonSets(ns).Get(context.Background(), ds.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		status := ds.Status
+		return status.ObservedGeneration >= ds.Generation && status.DesiredNumberScheduled > 0 && status.NumberReady == status.DesiredNumberScheduled, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		err = fmt.Errorf("daemonset %q never became ready", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := client.CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=" + name})
+	if err != nil {
+		return nil, err
+	}
+	probes := &nodeProbes{pods: map[string]string{}}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && len(pod.Spec.NodeName) > 0 {
+			probes.pods[pod.Spec.NodeName] = pod.Name
+		}
+	}
+	return probes, nil
+}
+
+// run runs check with the exec pod of every node at the same time and
+// returns the result of each node.
+func (p *nodeProbes) run(check func(execPodName string) error) map[string]error {
+	var (
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+		results = map[string]error{}
+	)
+	for node, pod := range p.pods {
+		wg.Add(1)
+		go func(node, pod string) {
+			defer g.GinkgoRecover()
+			defer wg.Done()
+			err := check(pod)
+			lock.Lock()
+			defer lock.Unlock()
+			results[node] = err
+		}(node, pod)
+	}
+	wg.Wait()
+	return results
+}
+
+// nodeProbeFailures returns an error that names every node whose check
+// failed, or nil if the check passed on every node.
+func nodeProbeFailures(results map[string]error) error {
+	var failed []string
+	for node, err := range results {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", node, err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("route check failed on %d of %d nodes:\n%s", len(failed), len(results), strings.Join(failed, "\n"))
+}
@@ -0,0 +1,223 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientset "k8s.io/client-go/kubernetes"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	image "k8s.io/kubernetes/test/utils/image"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc          *exutil.CLI
+		ns          string
+		routerImage string
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("router-", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-paths")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should route requests for a host to the route with the longest matching path", func() {
+			host := "paths.example.com"
+
+			// The backends respond to every path with the name of
+			// their pod, which is the name of their route.
+			g.By("creating a backend for each path")
+			routes := map[string]string{
+				"path-root":   "/",
+				"path-api":    "/api",
+				"path-api-v2": "/api/v2",
+			}
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			for name, path := range routes {
+				createServeHostnameBackend(oc.KubeClient(), ns, name)
+				_, err := routeClient.Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   name,
+						Labels: map[string]string{"select": "paths"},
+					},
+					Spec: routev1.RouteSpec{
+						Host: host,
+						Path: path,
+						To:   routev1.RouteTargetReference{Name: name},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By("deploying a router")
+			rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter("router-paths", routerImage, "select=paths"), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+			pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=router-paths"})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(pods.Items).To(o.HaveLen(1))
+			routerIP := pods.Items[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			request := func(path string) httpprobe.Request {
+				return httpprobe.Request{Host: host, Address: routerIP, Path: path, Timeout: 15 * time.Second}
+			}
+
+			g.By("waiting for the routes to respond")
+			for _, path := range routes {
+				_, err := prober.WaitForStatus(request(path), http.StatusOK, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred(), "the route for %s never responded", path)
+			}
+
+			// expectPaths expects every path to be served by the
+			// named route, or to get a 503 if the name is empty.
+			expectPaths := func(paths map[string]string) {
+				for path, name := range paths {
+					resp, err := prober.Do(request(path))
+					o.Expect(err).NotTo(o.HaveOccurred())
+					if len(name) == 0 {
+						o.Expect(resp.StatusCode).To(o.Equal(http.StatusServiceUnavailable), "%s should not be served by any route", path)
+						continue
+					}
+					o.Expect(resp.StatusCode).To(o.Equal(http.StatusOK), "%s should be served by the %s route", path, name)
+					o.Expect(strings.TrimSpace(string(resp.Body))).To(o.Equal(name), "%s should be served by the %s route", path, name)
+				}
+			}
+
+			g.By("checking that each path is served by the route with the longest matching path")
+			expectPaths(map[string]string{
+				"/":               "path-root",
+				"/other":          "path-root",
+				"/other/deeper":   "path-root",
+				"/api":            "path-api",
+				"/api/":           "path-api",
+				"/api/users":      "path-api",
+				"/api/v1/users":   "path-api",
+				"/api/v2":         "path-api-v2",
+				"/api/v2/":        "path-api-v2",
+				"/api/v2/users":   "path-api-v2",
+				"/api/v2/users/1": "path-api-v2",
+			})
+
+			g.By("deleting the route for /")
+			err = routeClient.Delete(context.Background(), "path-root", metav1.DeleteOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			_, err = prober.WaitForStatus(request("/"), http.StatusServiceUnavailable, changeTimeoutSeconds*time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred(), "the router kept serving / after its route was deleted")
+
+			g.By("checking that paths outside of the remaining routes are not served")
+			expectPaths(map[string]string{
+				"/":              "",
+				"/other":         "",
+				"/other/deeper":  "",
+				"/api":           "path-api",
+				"/api/users":     "path-api",
+				"/api/v2/users":  "path-api-v2",
+				"/api/v2/deeper": "path-api-v2",
+			})
+		})
+	})
+})
+
+// createServeHostnameBackend creates an agnhost serve-hostname pod, which
+// responds to requests for any path with its name, and a service of the same
+// name in namespace ns that exposes it on port 8080.
+func createServeHostnameBackend(client clientset.Interface, ns, name string) {
+	podLabels := map[string]string{"app": name}
+	_, err := client.CoreV1().Pods(ns).Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: podLabels,
+		},
+		Spec: corev1.PodSpec{
+			SecurityContext: e2epod.GetRestrictedPodSecurityContext(),
+			Containers: []corev1.Container{
+				{
+					Name:            name,
+					Image:           image.GetE2EImage(image.Agnhost),
+					Args:            []string{"serve-hostname", "--port", "8080"},
+					Ports:           []corev1.ContainerPort{{ContainerPort: 8080}},
+					SecurityContext: e2epod.GetRestrictedContainerSecurityContext(),
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+	e2e.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(client, name, ns))
+
+	_, err = client.CoreV1().Services(ns).Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: podLabels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       8080,
+					TargetPort: intstr.FromInt(8080),
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+}
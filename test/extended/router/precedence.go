@@ -0,0 +1,262 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+	image "k8s.io/kubernetes/test/utils/image"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/haproxyconfig"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc = exutil.NewCLI("router-precedence")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should give route annotations precedence over ingresscontroller tuning defaults", func() {
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			g.By("creating a backend that can delay its responses")
+			createNetexecBackend(oc.KubeClient(), ns, "precedence")
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// Each route exercises one cell of the precedence
+			// matrix: no annotation inherits the ingresscontroller
+			// default, and an annotation overrides it in either
+			// direction.
+			routes := []struct {
+				name string
+				// annotation is the value of the route timeout
+				// annotation, or empty to omit it.
+				annotation string
+				// expectedTimeout is the expected value of
+				// "timeout server" in the route's backend, or
+				// empty if the backend should not set it.
+				expectedTimeout string
+				// okDelay is a response delay in seconds that
+				// the route is expected to tolerate.
+				okDelay int
+				// timeoutDelay is a response delay in seconds
+				// that the route is expected to time out on,
+				// or zero to skip the check.
+				timeoutDelay int
+			}{
+				{name: "default-timeout", annotation: "", expectedTimeout: "", okDelay: 1, timeoutDelay: 8},
+				{name: "longer-timeout", annotation: "20s", expectedTimeout: "20s", okDelay: 8},
+				{name: "shorter-timeout", annotation: "2s", expectedTimeout: "2s", okDelay: 0, timeoutDelay: 4},
+			}
+
+			g.By("creating routes with and without the timeout annotation")
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			for _, route := range routes {
+				annotations := map[string]string{}
+				if len(route.annotation) > 0 {
+					annotations["haproxy.router.openshift.io/timeout"] = route.annotation
+				}
+				_, err := routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        route.name,
+						Annotations: annotations,
+					},
+					Spec: routev1.RouteSpec{
+						Host: route.name + "." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "precedence"},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By("creating a router shard with a 5s server timeout default")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.TuningOptions.ServerTimeout = &metav1.Duration{Duration: 5 * time.Second}
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+
+			for _, route := range routes {
+				_, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, route.name, shardName, true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q was not admitted", route.name)
+			}
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerPod := routerPods[0]
+
+			g.By("verifying the rendered configuration")
+			var config *haproxyconfig.Config
+			err = wait.Poll(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+				config, err = getRouterConfig(routerPod.Namespace, routerPod.Name)
+				if err != nil {
+					e2e.Logf("failed to read router config: %v, retrying...", err)
+					return false, nil
+				}
+				for _, route := range routes {
+					if config.Backend(haproxyconfig.BackendName("", ns, route.name)) == nil {
+						return false, nil
+					}
+				}
+				return true, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred(), "router config never included all of the routes")
+
+			defaultTimeout, ok := config.Defaults().Get("timeout server")
+			o.Expect(ok).To(o.BeTrue(), "expected a default server timeout")
+			o.Expect(defaultTimeout).To(o.Equal("5s"))
+			for _, route := range routes {
+				backend := config.Backend(haproxyconfig.BackendName("", ns, route.name))
+				timeout, ok := backend.Get("timeout server")
+				if len(route.expectedTimeout) == 0 {
+					o.Expect(ok).To(o.BeFalse(), "route %q should inherit the default server timeout, got %q", route.name, timeout)
+					continue
+				}
+				o.Expect(ok).To(o.BeTrue(), "route %q should override the default server timeout", route.name)
+				o.Expect(timeout).To(o.Equal(route.expectedTimeout), "route %q", route.name)
+			}
+
+			g.By("verifying the observed timeouts")
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			routerURL := fmt.Sprintf("http://%s", net.JoinHostPort(routerPod.Status.PodIP, "80"))
+			for _, route := range routes {
+				host := route.name + "." + shardFQDN
+				err := waitForRouterOKResponseExec(ns, execPod.Name, routerURL+"/echo?msg=ok", host, changeTimeoutSeconds)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q never became reachable", route.name)
+
+				err = expectRouteStatusCodeExec(ns, execPod.Name, fmt.Sprintf("%s/shell?cmd=sleep%%20%d", routerURL, route.okDelay), host, 200)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q should tolerate a %ds delay", route.name, route.okDelay)
+
+				if route.timeoutDelay > 0 {
+					err = expectRouteStatusCodeExec(ns, execPod.Name, fmt.Sprintf("%s/shell?cmd=sleep%%20%d", routerURL, route.timeoutDelay), host, 504)
+					o.Expect(err).NotTo(o.HaveOccurred(), "route %q should time out on a %ds delay", route.name, route.timeoutDelay)
+				}
+			}
+		})
+	})
+})
+
+// createNetexecBackend creates an agnhost netexec pod and a service of the
+// same name in namespace ns that exposes it on port 8080.
+func createNetexecBackend(client clientset.Interface, ns, name string) {
+	podLabels := map[string]string{"app": name}
+	createNetexecPod(client, ns, name, podLabels)
+
+	_, err := client.CoreV1().Services(ns).Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: podLabels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       8080,
+					TargetPort: intstr.FromInt(8080),
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+}
+
+// createNetexecPod creates an agnhost netexec pod with the given labels in
+// namespace ns and waits for it to run.  More pods with the labels of a
+// netexec backend add endpoints to its service.
+func createNetexecPod(client clientset.Interface, ns, name string, podLabels map[string]string) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: podLabels,
+		},
+		Spec: corev1.PodSpec{
+			SecurityContext: e2epod.GetRestrictedPodSecurityContext(),
+			Containers: []corev1.Container{
+				{
+					Name:            name,
+					Image:           image.GetE2EImage(image.Agnhost),
+					Args:            []string{"netexec", "--http-port", "8080"},
+					Ports:           []corev1.ContainerPort{{ContainerPort: 8080}},
+					SecurityContext: e2epod.GetRestrictedContainerSecurityContext(),
+				},
+			},
+		},
+	}
+	_, err := client.CoreV1().Pods(ns).Create(context.Background(), pod, metav1.CreateOptions{})
+	o.Expect(err).NotTo(o.HaveOccurred())
+	e2e.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(client, name, ns))
+}
+
+// getRouterConfig reads and parses the haproxy configuration of the given
+// router pod.
+func getRouterConfig(ns, podName string) (*haproxyconfig.Config, error) {
+	output, err := e2e.RunHostCmd(ns, podName, "cat /var/lib/haproxy/conf/haproxy.config")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the haproxy config from %s/%s: %v", ns, podName, err)
+	}
+	return haproxyconfig.Parse(output), nil
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	g "github.com/onsi/ginkgo"
@@ -10,8 +11,12 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
 
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/certgen"
+	"github.com/openshift/origin/test/extended/router/httpprobe"
 	exutil "github.com/openshift/origin/test/extended/util"
 )
 
@@ -58,23 +63,105 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 			err := oc.Run("create").Args("-f", configPath).Execute()
 			o.Expect(err).NotTo(o.HaveOccurred())
 
-			var hostname string
-			err = wait.Poll(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
-				route, err := oc.RouteClient().RouteV1().Routes(ns).Get(context.Background(), "serving-cert", metav1.GetOptions{})
-				if err != nil {
-					return false, err
-				}
-				if len(route.Status.Ingress) == 0 || len(route.Status.Ingress[0].Host) == 0 {
-					return false, nil
-				}
-				hostname = route.Status.Ingress[0].Host
-				return true, nil
-			})
+			hostname, err := waitForRouteHost(oc, ns, "serving-cert")
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			// don't assume the router is available via external DNS, because of complexity
 			err = waitForRouterOKResponseExec(ns, execPod.Name, routerURL, hostname, changeTimeoutSeconds)
 			o.Expect(err).NotTo(o.HaveOccurred())
 		})
+
+		g.It("should verify the serving certificate of a reencrypt backend against the destination CA of the route", func() {
+			prober, routerAddress, cleanup := defaultRouterProber(oc, ns)
+			defer cleanup()
+
+			g.By("deploying a service using a reencrypt route without a destinationCACertificate")
+			err := oc.Run("create").Args("-f", configPath).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+			hostname, err := waitForRouteHost(oc, ns, "serving-cert")
+			o.Expect(err).NotTo(o.HaveOccurred())
+			req := httpprobe.Request{Scheme: "https", Host: hostname, Address: routerAddress, Timeout: 15 * time.Second}
+
+			// Without a destination CA the router verifies the backend
+			// with the service-serving signer, which signed its
+			// certificate.
+			g.By("checking that the backend is verified with the service CA by default")
+			_, err = prober.WaitForStatus(req, http.StatusOK, changeTimeoutSeconds*time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			notBefore := time.Now().Add(-24 * time.Hour)
+			notAfter := time.Now().Add(24 * time.Hour)
+			unrelatedCA, _, _, err := certgen.GenerateKeyPair(notBefore, notAfter)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			unrelatedCAPEM, err := certgen.MarshalCertToPEMString(unrelatedCA)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			serviceCA, err := waitForServiceCA(oc, ns)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// Each step changes the outcome of the previous one, so
+			// that waiting for the expected status also waits for the
+			// router to reload with the new destination CA.
+			for _, step := range []struct {
+				description   string
+				destinationCA string
+				statusCode    int
+			}{
+				{description: "a CA that did not sign the serving certificate", destinationCA: unrelatedCAPEM, statusCode: http.StatusServiceUnavailable},
+				{description: "the service CA", destinationCA: serviceCA, statusCode: http.StatusOK},
+			} {
+				g.By(fmt.Sprintf("setting the destination CA of the route to %s", step.description))
+				client := oc.AdminRouteClient().RouteV1().Routes(ns)
+				route, err := client.Get(context.Background(), "serving-cert", metav1.GetOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				route.Spec.TLS.DestinationCACertificate = step.destinationCA
+				_, err = client.Update(context.Background(), route, metav1.UpdateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+
+				_, err = prober.WaitForStatus(req, step.statusCode, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred(), "the route never responded with %d", step.statusCode)
+				for i := 0; i < 5; i++ {
+					resp, err := prober.Do(req)
+					o.Expect(err).NotTo(o.HaveOccurred())
+					o.Expect(resp.StatusCode).To(o.Equal(step.statusCode))
+				}
+			}
+		})
 	})
 })
+
+// waitForRouteHost waits for a router to admit the named route and returns
+// the host that the router admitted it with.
+func waitForRouteHost(oc *exutil.CLI, ns, name string) (string, error) {
+	var hostname string
+	err := wait.Poll(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+		route, err := oc.RouteClient().RouteV1().Routes(ns).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if len(route.Status.Ingress) == 0 || len(route.Status.Ingress[0].Host) == 0 {
+			return false, nil
+		}
+		hostname = route.Status.Ingress[0].Host
+		return true, nil
+	})
+	return hostname, err
+}
+
+// waitForServiceCA waits for the service CA bundle to be injected into
+// namespace ns and returns it.
+func waitForServiceCA(oc *exutil.CLI, ns string) (string, error) {
+	var serviceCA string
+	err := wait.PollImmediate(time.Second, time.Minute, func() (bool, error) {
+		cm, err := oc.KubeClient().CoreV1().ConfigMaps(ns).Get(context.Background(), "openshift-service-ca.crt", metav1.GetOptions{})
+		if err != nil {
+			e2e.Logf("unable to get the service CA bundle: %v", err)
+			return false, nil
+		}
+		serviceCA = cm.Data["service-ca.crt"]
+		return len(serviceCA) > 0, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("the service CA bundle was not injected: %v", err)
+	}
+	return serviceCA, nil
+}
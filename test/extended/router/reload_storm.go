@@ -0,0 +1,164 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/availability"
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/routerstats"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+// reloadInterval is the minimum interval between the reloads of the router
+// that the reload tests deploy.
+const reloadInterval = 5 * time.Second
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc          *exutil.CLI
+		ns          string
+		routerImage string
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("router-", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-reload-storm")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should coalesce a burst of route creations into a bounded number of reloads without failing requests", func() {
+			g.By("creating a backend and a route to it")
+			createNetexecBackend(oc.KubeClient(), ns, "reload-storm")
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			createRoute := func(name, host string) {
+				_, err := routeClient.Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   name,
+						Labels: map[string]string{"select": "reload-storm"},
+					},
+					Spec: routev1.RouteSpec{
+						Host: host,
+						To:   routev1.RouteTargetReference{Name: "reload-storm"},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+			host := "reload-storm.example.com"
+			createRoute("reload-storm", host)
+
+			g.By("deploying a router")
+			rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter("router-reload-storm", routerImage, "select=reload-storm", fmt.Sprintf("--interval=%s", reloadInterval)), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+			pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=router-reload-storm"})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(pods.Items).To(o.HaveLen(1))
+			routerIP := pods.Items[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			statsClient := routerstats.ForTestRouter(ns, execPod.Name, routerIP)
+			request := func(host string) httpprobe.Request {
+				return httpprobe.Request{Host: host, Address: routerIP, Path: "/echo?msg=ok", Timeout: 15 * time.Second}
+			}
+
+			g.By("waiting for the route to respond and the router to stop reloading")
+			_, err = prober.WaitForStatus(request(host), http.StatusOK, changeTimeoutSeconds*time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			_, err = waitForStableReloads(statsClient)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			before, err := statsClient.Reloads()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// Requests for the existing route run for the whole burst,
+			// so that they span every reload that it causes.
+			stopRequests := availability.StartRouteAvailabilityMonitor("reload-storm", prober, request(host))
+			defer stopRequests()
+
+			routes := 30
+			g.By(fmt.Sprintf("creating %d routes in a burst", routes))
+			start := time.Now()
+			for i := 0; i < routes; i++ {
+				createRoute(fmt.Sprintf("reload-storm-%d", i), fmt.Sprintf("reload-storm-%d.example.com", i))
+			}
+			for i := 0; i < routes; i++ {
+				_, err := prober.WaitForStatus(request(fmt.Sprintf("reload-storm-%d.example.com", i)), http.StatusOK, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route reload-storm-%d never responded", i)
+			}
+			elapsed := time.Since(start)
+			report := stopRequests()
+
+			after, err := statsClient.Reloads()
+			o.Expect(err).NotTo(o.HaveOccurred())
+			reloads := after.Since(before)
+			e2e.Logf("the router served %d new routes after %s with %s", routes, elapsed, reloads)
+
+			// The router reloads at most once per interval while
+			// changes keep arriving, plus once for the changes that
+			// arrive after the last reload.
+			maxReloads := uint64(elapsed/reloadInterval) + 2
+			g.By(fmt.Sprintf("checking that the burst caused between 1 and %d reloads", maxReloads))
+			o.Expect(reloads.Count).To(o.BeNumerically(">=", 1))
+			o.Expect(reloads.Count).To(o.BeNumerically("<=", maxReloads), "the router reloaded more often than every %s", reloadInterval)
+
+			g.By("checking that no request for the existing route failed during the reloads")
+			o.Expect(report.Requests).To(o.BeNumerically(">", 0))
+			o.Expect(report.Failures).To(o.BeZero(), "%s", report)
+		})
+	})
+})
@@ -0,0 +1,206 @@
+// Package routerstats is a client for the health, metrics and statistics
+// endpoints that the router serves on its stats port.
+package routerstats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+)
+
+const (
+	// DefaultPort is the stats port of the routers that the tests deploy
+	// and of the routers that the ingress operator manages.
+	DefaultPort = 1936
+
+	// ingressNamespace is where the ingress operator runs routers and
+	// stores their stats credentials.
+	ingressNamespace = "openshift-ingress"
+
+	// TestRouterUsername and TestRouterPassword are the stats credentials
+	// of the routers that the tests deploy, from labelSelectingRouter or
+	// from the router templates in testdata.
+	TestRouterUsername = "admin"
+	TestRouterPassword = "password"
+)
+
+// Client queries a router's stats port.  Requests are made with curl from an
+// exec pod because router pod IPs are generally only reachable from inside
+// the cluster.
+type Client struct {
+	namespace string
+	execPod   string
+	baseURL   string
+
+	username    string
+	password    string
+	bearerToken string
+}
+
+// New returns a client for the stats port at host:port that makes its
+// requests from execPod in namespace.  A zero port selects DefaultPort.
+func New(namespace, execPod, host string, port int) *Client {
+	if port == 0 {
+		port = DefaultPort
+	}
+	return &Client{
+		namespace: namespace,
+		execPod:   execPod,
+		baseURL:   fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(port))),
+	}
+}
+
+// ForTestRouter returns a client for the stats port of a router that a test
+// deployed at host, that authenticates with TestRouterUsername and
+// TestRouterPassword.
+func ForTestRouter(namespace, execPod, host string) *Client {
+	return New(namespace, execPod, host, DefaultPort).WithBasicAuth(TestRouterUsername, TestRouterPassword)
+}
+
+// Credentials returns the stats username and password of the named
+// ingresscontroller's routers.
+func Credentials(client kubernetes.Interface, name string) (string, string, error) {
+	secretName := "router-stats-" + name
+	secret, err := client.CoreV1().Secrets(ingressNamespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get the stats credentials secret %s/%s: %v", ingressNamespace, secretName, err)
+	}
+	username, password := string(secret.Data["statsUsername"]), string(secret.Data["statsPassword"])
+	if len(username) == 0 || len(password) == 0 {
+		return "", "", fmt.Errorf("secret %s/%s has no stats credentials", ingressNamespace, secretName)
+	}
+	return username, password, nil
+}
+
+// WithBasicAuth returns a copy of the client that authenticates with the
+// given username and password.
+func (c *Client) WithBasicAuth(username, password string) *Client {
+	copied := *c
+	copied.username, copied.password, copied.bearerToken = username, password, ""
+	return &copied
+}
+
+// WithBearerToken returns a copy of the client that authenticates with the
+// given bearer token, as prometheus does.
+func (c *Client) WithBearerToken(token string) *Client {
+	copied := *c
+	copied.username, copied.password, copied.bearerToken = "", "", token
+	return &copied
+}
+
+// Get requests path from the stats port and returns the status code and body
+// of the response.
+func (c *Client) Get(path string) (int, string, error) {
+	var auth string
+	switch {
+	case len(c.bearerToken) > 0:
+		auth = fmt.Sprintf("-H %s ", shellQuote("Authorization: Bearer "+c.bearerToken))
+	case len(c.username) > 0:
+		auth = fmt.Sprintf("-u %s ", shellQuote(c.username+":"+c.password))
+	}
+	url := c.baseURL + path
+	cmd := fmt.Sprintf("curl -s -S -m 10 %s-w '\\n%%{http_code}' %s", auth, shellQuote(url))
+	output, err := e2e.RunHostCmd(c.namespace, c.execPod, cmd)
+	if err != nil {
+		return 0, "", fmt.Errorf("request to %s failed: %v\n%s", url, err, output)
+	}
+	i := strings.LastIndex(output, "\n")
+	if i < 0 {
+		return 0, "", fmt.Errorf("unexpected curl output for %s: %q", url, output)
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(output[i+1:]))
+	if err != nil {
+		return 0, "", fmt.Errorf("unexpected curl output for %s: %q", url, output)
+	}
+	return status, output[:i], nil
+}
+
+// getOK is Get, except that any status code other than 200 is an error.
+func (c *Client) getOK(path string) (string, error) {
+	status, body, err := c.Get(path)
+	if err != nil {
+		return "", err
+	}
+	if status != 200 {
+		return "", fmt.Errorf("unexpected status %d from %s%s: %s", status, c.baseURL, path, body)
+	}
+	return body, nil
+}
+
+// Healthz returns an error unless the router reports that it is healthy.
+func (c *Client) Healthz() error {
+	_, err := c.getOK("/healthz")
+	return err
+}
+
+// Ready returns an error unless the router reports that it is ready, that is,
+// that it has loaded its initial configuration.
+func (c *Client) Ready() error {
+	_, err := c.getOK("/healthz/ready")
+	return err
+}
+
+// WaitForHealthz polls Healthz until it succeeds or timeout expires.
+func (c *Client) WaitForHealthz(timeout time.Duration) error {
+	return c.poll("/healthz", c.Healthz, timeout)
+}
+
+// WaitForReady polls Ready until it succeeds or timeout expires.
+func (c *Client) WaitForReady(timeout time.Duration) error {
+	return c.poll("/healthz/ready", c.Ready, timeout)
+}
+
+func (c *Client) poll(path string, check func() error, timeout time.Duration) error {
+	var lastErr error
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		if lastErr = check(); lastErr != nil {
+			e2e.Logf("%s%s: %v, retrying...", c.baseURL, path, lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil && lastErr != nil {
+		return fmt.Errorf("%v: %v", err, lastErr)
+	}
+	return err
+}
+
+// Metrics returns the router's prometheus metrics by name.
+func (c *Client) Metrics() (map[string]*dto.MetricFamily, error) {
+	body, err := c.getOK("/metrics")
+	if err != nil {
+		return nil, err
+	}
+	p := expfmt.TextParser{}
+	metrics, err := p.TextToMetricFamilies(bytes.NewBufferString(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics from %s: %v", c.baseURL, err)
+	}
+	return metrics, nil
+}
+
+// Stats returns haproxy's statistics in CSV form, parsed.
+func (c *Client) Stats() (*Stats, error) {
+	body, err := c.getOK("/;csv")
+	if err != nil {
+		return nil, err
+	}
+	return ParseStats(body)
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
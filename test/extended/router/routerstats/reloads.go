@@ -0,0 +1,62 @@
+package routerstats
+
+import (
+	"fmt"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ReloadMetric is the summary, or the histogram in some router versions, of
+// the time the router takes to reload haproxy.
+const ReloadMetric = "template_router_reload_seconds"
+
+// Reloads is how often the router reloaded haproxy and how long the reloads
+// took in total.
+type Reloads struct {
+	Count   uint64
+	Seconds float64
+}
+
+// Since returns the reloads that happened after r0 was observed.
+func (r Reloads) Since(r0 Reloads) Reloads {
+	return Reloads{Count: r.Count - r0.Count, Seconds: r.Seconds - r0.Seconds}
+}
+
+// Mean returns the mean duration of the reloads, or zero if there were none.
+func (r Reloads) Mean() time.Duration {
+	if r.Count == 0 {
+		return 0
+	}
+	return time.Duration(r.Seconds / float64(r.Count) * float64(time.Second))
+}
+
+func (r Reloads) String() string {
+	return fmt.Sprintf("%d reloads taking %s on average", r.Count, r.Mean())
+}
+
+// ParseReloads returns the reloads that metrics report.
+func ParseReloads(metrics map[string]*dto.MetricFamily) (Reloads, error) {
+	family, ok := metrics[ReloadMetric]
+	if !ok || len(family.Metric) == 0 {
+		return Reloads{}, fmt.Errorf("the router does not report %s", ReloadMetric)
+	}
+	m := family.Metric[0]
+	switch {
+	case m.Summary != nil:
+		return Reloads{Count: m.Summary.GetSampleCount(), Seconds: m.Summary.GetSampleSum()}, nil
+	case m.Histogram != nil:
+		return Reloads{Count: m.Histogram.GetSampleCount(), Seconds: m.Histogram.GetSampleSum()}, nil
+	default:
+		return Reloads{}, fmt.Errorf("%s is neither a summary nor a histogram", ReloadMetric)
+	}
+}
+
+// Reloads returns how often the router reloaded haproxy so far.
+func (c *Client) Reloads() (Reloads, error) {
+	metrics, err := c.Metrics()
+	if err != nil {
+		return Reloads{}, err
+	}
+	return ParseReloads(metrics)
+}
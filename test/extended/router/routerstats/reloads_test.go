@@ -0,0 +1,84 @@
+package routerstats_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/openshift/origin/test/extended/router/routerstats"
+)
+
+func TestParseReloads(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		metrics string
+		want    routerstats.Reloads
+		wantErr bool
+	}{
+		{
+			name: "summary",
+			metrics: `# TYPE template_router_reload_seconds summary
+template_router_reload_seconds{quantile="0.5"} 0.1
+template_router_reload_seconds_sum 1.5
+template_router_reload_seconds_count 6
+`,
+			want: routerstats.Reloads{Count: 6, Seconds: 1.5},
+		},
+		{
+			name: "histogram",
+			metrics: `# TYPE template_router_reload_seconds histogram
+template_router_reload_seconds_bucket{le="1"} 3
+template_router_reload_seconds_bucket{le="+Inf"} 4
+template_router_reload_seconds_sum 2
+template_router_reload_seconds_count 4
+`,
+			want: routerstats.Reloads{Count: 4, Seconds: 2},
+		},
+		{
+			name: "missing",
+			metrics: `# TYPE template_router_write_config_seconds summary
+template_router_write_config_seconds_sum 1
+template_router_write_config_seconds_count 1
+`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := expfmt.TextParser{}
+			metrics, err := p.TextToMetricFamilies(bytes.NewBufferString(tc.metrics))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := routerstats.ParseReloads(metrics)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestReloadsSince(t *testing.T) {
+	before := routerstats.Reloads{Count: 2, Seconds: 1}
+	after := routerstats.Reloads{Count: 6, Seconds: 3}
+	got := after.Since(before)
+	if got.Count != 4 {
+		t.Errorf("expected 4 reloads, got %d", got.Count)
+	}
+	if got.Mean() != 500*time.Millisecond {
+		t.Errorf("expected a mean of 500ms, got %s", got.Mean())
+	}
+	if (routerstats.Reloads{}).Mean() != 0 {
+		t.Errorf("expected a zero mean without reloads")
+	}
+}
@@ -0,0 +1,104 @@
+package routerstats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// frontendServer and backendServer are the server names of the rows
+	// that summarize a whole frontend or backend.
+	frontendServer = "FRONTEND"
+	backendServer  = "BACKEND"
+)
+
+// Row is a single line of haproxy's CSV statistics, keyed by column name,
+// for example "pxname", "svname", "status" or "stot".
+type Row map[string]string
+
+// Proxy returns the name of the frontend or backend that the row belongs to.
+func (r Row) Proxy() string {
+	return r["pxname"]
+}
+
+// Server returns the name of the server that the row describes, or
+// "FRONTEND" or "BACKEND" for summary rows.
+func (r Row) Server() string {
+	return r["svname"]
+}
+
+// Int returns the value of the named column as an integer.  Columns that are
+// empty because they do not apply to the row are reported as zero.
+func (r Row) Int(column string) (int64, error) {
+	value, ok := r[column]
+	if !ok {
+		return 0, fmt.Errorf("no column %q in the stats of %s/%s", column, r.Proxy(), r.Server())
+	}
+	if len(value) == 0 {
+		return 0, nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("column %q of %s/%s is not an integer: %v", column, r.Proxy(), r.Server(), err)
+	}
+	return i, nil
+}
+
+// Stats is haproxy's CSV statistics.
+type Stats struct {
+	Rows []Row
+}
+
+// ParseStats parses the output of haproxy's ";csv" stats page.
+func ParseStats(contents string) (*Stats, error) {
+	// The header is the first line, prefixed with "# ".
+	contents = strings.TrimPrefix(strings.TrimLeft(contents, " \n"), "# ")
+	r := csv.NewReader(strings.NewReader(contents))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stats: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("failed to parse stats: no header")
+	}
+
+	header := records[0]
+	stats := &Stats{}
+	for _, record := range records[1:] {
+		row := Row{}
+		for i, column := range header {
+			if len(column) > 0 && i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		stats.Rows = append(stats.Rows, row)
+	}
+	return stats, nil
+}
+
+// Backend returns the summary row of the named backend, and whether it was
+// found.
+func (s *Stats) Backend(name string) (Row, bool) {
+	for _, row := range s.Rows {
+		if row.Proxy() == name && row.Server() == backendServer {
+			return row, true
+		}
+	}
+	return nil, false
+}
+
+// Servers returns the rows of the individual servers of the named backend,
+// in the order in which haproxy reports them.
+func (s *Stats) Servers(backend string) []Row {
+	var servers []Row
+	for _, row := range s.Rows {
+		if row.Proxy() != backend || row.Server() == frontendServer || row.Server() == backendServer {
+			continue
+		}
+		servers = append(servers, row)
+	}
+	return servers
+}
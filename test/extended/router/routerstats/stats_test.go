@@ -0,0 +1,61 @@
+package routerstats_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openshift/origin/test/extended/router/routerstats"
+)
+
+const sample = `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,status,
+public,FRONTEND,,,1,3,20000,42,1024,2048,OPEN,
+be_http:ns:weightedroute,pod:a:svc:10.0.0.1:8080,0,0,0,1,,30,0,0,UP,
+be_http:ns:weightedroute,pod:b:svc:10.0.0.2:8080,0,0,0,1,,10,0,0,UP,
+be_http:ns:weightedroute,BACKEND,0,0,0,1,2000,40,0,0,UP,
+be_http:ns:other,pod:c:svc:10.0.0.3:8080,0,0,0,0,,0,0,0,DOWN,
+be_http:ns:other,BACKEND,0,0,0,0,2000,0,0,0,DOWN,
+`
+
+func TestParseStats(t *testing.T) {
+	stats, err := routerstats.ParseStats(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Rows) != 6 {
+		t.Fatalf("expected 6 rows, got %d", len(stats.Rows))
+	}
+
+	var servers []string
+	var total int64
+	for _, row := range stats.Servers("be_http:ns:weightedroute") {
+		servers = append(servers, row.Server())
+		stot, err := row.Int("stot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += stot
+	}
+	if diff := cmp.Diff([]string{"pod:a:svc:10.0.0.1:8080", "pod:b:svc:10.0.0.2:8080"}, servers); diff != "" {
+		t.Errorf("unexpected servers (-want +got):\n%s", diff)
+	}
+	if total != 40 {
+		t.Errorf("expected 40 sessions across the servers, got %d", total)
+	}
+
+	backend, ok := stats.Backend("be_http:ns:other")
+	if !ok {
+		t.Fatalf("expected to find the other backend")
+	}
+	if backend["status"] != "DOWN" {
+		t.Errorf("expected the other backend to be down, got %q", backend["status"])
+	}
+	if slim, err := stats.Servers("be_http:ns:other")[0].Int("slim"); err != nil || slim != 0 {
+		t.Errorf("expected an empty column to be zero, got %d, %v", slim, err)
+	}
+	if _, err := backend.Int("missing"); err == nil {
+		t.Errorf("expected an error for a missing column")
+	}
+	if _, ok := stats.Backend("be_http:ns:missing"); ok {
+		t.Errorf("expected no backend for a missing route")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 
 	exutil "github.com/openshift/origin/test/extended/util"
+	"github.com/openshift/origin/test/extended/util/certs"
 )
 
 const changeTimeoutSeconds = 3 * 60
@@ -28,9 +29,10 @@ const changeTimeoutSeconds = 3 * 60
 var _ = g.Describe("[sig-network][Feature:Router]", func() {
 	defer g.GinkgoRecover()
 	var (
-		oc          *exutil.CLI
-		ns          string
-		routerImage string
+		oc                 *exutil.CLI
+		ns                 string
+		routerImage        string
+		defaultCertificate string
 	)
 
 	// this hook must be registered before the framework namespace teardown
@@ -54,6 +56,9 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 		routerImage, err = exutil.FindRouterImage(oc)
 		o.Expect(err).NotTo(o.HaveOccurred())
 
+		defaultCertificate, err = certs.NewDefaultCertificate("*.example.com")
+		o.Expect(err).NotTo(o.HaveOccurred())
+
 		configPath := exutil.FixturePath("testdata", "router", "router-common.yaml")
 		err = oc.AsAdmin().Run("new-app").Args("-f", configPath).Execute()
 		o.Expect(err).NotTo(o.HaveOccurred())
@@ -64,7 +69,7 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 
 			configPath := exutil.FixturePath("testdata", "router", "router-scoped.yaml")
 			g.By(fmt.Sprintf("creating a router from a config file %q", configPath))
-			err := oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage).Execute()
+			err := oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage, "-p", "DEFAULT_CERTIFICATE="+defaultCertificate).Execute()
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			ns := oc.KubeFramework().Namespace.Name
@@ -109,7 +114,7 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 
 			configPath := exutil.FixturePath("testdata", "router", "router-override.yaml")
 			g.By(fmt.Sprintf("creating a router from a config file %q", configPath))
-			err := oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage).Execute()
+			err := oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage, "-p", "DEFAULT_CERTIFICATE="+defaultCertificate).Execute()
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			ns := oc.KubeFramework().Namespace.Name
@@ -173,7 +178,7 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 
 			configPath := exutil.FixturePath("testdata", "router", "router-override-domains.yaml")
 			g.By(fmt.Sprintf("creating a router from a config file %q", configPath))
-			err := oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage).Execute()
+			err := oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage, "-p", "DEFAULT_CERTIFICATE="+defaultCertificate).Execute()
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			ns := oc.KubeFramework().Namespace.Name
@@ -317,15 +322,6 @@ func expectRouteStatusCodeExec(ns, execPodName, url, host string, statusCode int
 	return nil
 }
 
-func getAuthenticatedRouteURLViaPod(ns, execPodName, url, host, user, pass string) (string, error) {
-	cmd := fmt.Sprintf("curl -s -u %s:%s --header 'Host: %s' %q", user, pass, host, url)
-	output, err := e2e.RunHostCmd(ns, execPodName, cmd)
-	if err != nil {
-		return "", fmt.Errorf("host command failed: %v\n%s", err, output)
-	}
-	return output, nil
-}
-
 func ingressForName(r *routev1.Route, name string) *routev1.RouteIngress {
 	for i, ingress := range r.Status.Ingress {
 		if ingress.RouterName == name {
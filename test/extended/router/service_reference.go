@@ -0,0 +1,275 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	utilnet "k8s.io/utils/net"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc = exutil.NewCLI("router-service-reference")
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should not serve routes whose service does not exist in the route's namespace", func() {
+			ns := oc.Namespace()
+
+			g.By("creating a backend in the route's namespace")
+			createNetexecBackend(oc.KubeClient(), ns, "local")
+
+			g.By("creating a backend in another namespace")
+			otherNs := oc.CreateProject()
+			createNetexecBackend(oc.AdminKubeClient(), otherNs, "elsewhere")
+
+			routes := []struct {
+				name string
+				// service is the value of spec.to.name.
+				service string
+				// mayBeRejected is true if the API server is
+				// allowed to reject the route as invalid.
+				mayBeRejected bool
+				// statusCode is the expected response when the
+				// route is admitted.
+				statusCode int
+			}{
+				{name: "local-service", service: "local", statusCode: http.StatusOK},
+				{name: "missing-service", service: "does-not-exist", statusCode: http.StatusServiceUnavailable},
+				{name: "other-namespace-service", service: "elsewhere", statusCode: http.StatusServiceUnavailable},
+				{name: "qualified-service", service: otherNs + "/elsewhere", mayBeRejected: true, statusCode: http.StatusServiceUnavailable},
+			}
+
+			g.By("creating routes that reference local, missing and foreign services")
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			created := map[string]bool{}
+			for _, route := range routes {
+				_, err := routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: route.name,
+					},
+					Spec: routev1.RouteSpec{
+						To: routev1.RouteTargetReference{Name: route.service},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}, metav1.CreateOptions{})
+				if route.mayBeRejected && kerrors.IsInvalid(err) {
+					e2e.Logf("route %q referencing service %q was rejected: %v", route.name, route.service, err)
+					continue
+				}
+				o.Expect(err).NotTo(o.HaveOccurred())
+				created[route.name] = true
+			}
+
+			// The router does not check that the service exists when
+			// it admits a route, so every route is expected to be
+			// admitted; what matters is that nothing is served for
+			// the ones without a local service.
+			g.By("verifying that the default router admits the routes")
+			hosts := map[string]string{}
+			for _, route := range routes {
+				if !created[route.name] {
+					continue
+				}
+				host, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, route.name, "default", true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q was not admitted", route.name)
+				hosts[route.name] = host
+
+				r, err := routeClient.Routes(ns).Get(context.Background(), route.name, metav1.GetOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				status, _ := IngressConditionStatus(findIngress(r, "default"), routev1.RouteAdmitted)
+				o.Expect(status).To(o.Equal(corev1.ConditionTrue), "route %q", route.name)
+			}
+
+			routerPods, err := shard.GetRouterShardPods(oc, "default")
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerURL := fmt.Sprintf("http://%s", net.JoinHostPort(routerPods[0].Status.PodIP, "80"))
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			g.By("waiting for the route with a local service to be served")
+			err = waitForRouterOKResponseExec(ns, execPod.Name, routerURL+"/echo?msg=ok", hosts["local-service"], changeTimeoutSeconds)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("verifying that routes without a local service are not served")
+			for _, route := range routes {
+				if !created[route.name] || route.statusCode == http.StatusOK {
+					continue
+				}
+				err := expectRouteStatusCodeRepeatedExec(ns, execPod.Name, routerURL+"/echo?msg=ok", hosts[route.name], route.statusCode, 5, false)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q", route.name)
+			}
+		})
+
+		g.It("should serve routes to services without a selector, NodePort services and ExternalName services", func() {
+			ns := oc.Namespace()
+
+			g.By("creating a backend pod without a service")
+			createNetexecPod(oc.KubeClient(), ns, "manual-backend", map[string]string{"app": "manual-backend"})
+			pod, err := oc.KubeClient().CoreV1().Pods(ns).Get(context.Background(), "manual-backend", metav1.GetOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			podIP := pod.Status.PodIP
+
+			g.By("creating a service without a selector, a NodePort service and an ExternalName service")
+			port := corev1.ServicePort{
+				Name:       "http",
+				Port:       8080,
+				TargetPort: intstr.FromInt(8080),
+			}
+			for _, service := range []*corev1.Service{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "no-selector"},
+					Spec: corev1.ServiceSpec{
+						Ports: []corev1.ServicePort{port},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "node-port"},
+					Spec: corev1.ServiceSpec{
+						Type:     corev1.ServiceTypeNodePort,
+						Selector: map[string]string{"app": "manual-backend"},
+						Ports:    []corev1.ServicePort{port},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "external-name"},
+					Spec: corev1.ServiceSpec{
+						Type:         corev1.ServiceTypeExternalName,
+						ExternalName: fmt.Sprintf("node-port.%s.svc.cluster.local", ns),
+						Ports:        []corev1.ServicePort{port},
+					},
+				},
+			} {
+				_, err := oc.KubeClient().CoreV1().Services(ns).Create(context.Background(), service, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By("creating a route to each service")
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			hosts := map[string]string{}
+			for _, service := range []string{"no-selector", "node-port", "external-name"} {
+				_, err := routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: service,
+					},
+					Spec: routev1.RouteSpec{
+						To: routev1.RouteTargetReference{Name: service},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				host, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, service, "default", true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q was not admitted", service)
+				hosts[service] = host
+			}
+
+			prober, routerAddress, cleanup := defaultRouterProber(oc, ns)
+			defer cleanup()
+			request := func(service string) httpprobe.Request {
+				return httpprobe.Request{Host: hosts[service], Address: routerAddress, Path: "/echo?msg=ok", Timeout: 15 * time.Second}
+			}
+			expectStatus := func(service string, status int) {
+				_, err := prober.WaitForStatus(request(service), status, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q", service)
+			}
+
+			g.By("verifying that the route to the NodePort service is served by its endpoints")
+			expectStatus("node-port", http.StatusOK)
+
+			// The router proxies to the endpoints of a service, and
+			// an ExternalName service has none, so the router must
+			// neither resolve the external name nor fail to load the
+			// route.
+			g.By("verifying that the route to the ExternalName service is served as a route without endpoints")
+			expectStatus("external-name", http.StatusServiceUnavailable)
+
+			g.By("verifying that the route to the service without a selector has no endpoints")
+			expectStatus("no-selector", http.StatusServiceUnavailable)
+
+			// Endpoints of cluster network addresses are restricted,
+			// so the endpointslice is created by an admin.
+			g.By("adding the backend pod to a manually managed endpointslice of the service without a selector")
+			addressType := discoveryv1.AddressTypeIPv4
+			if utilnet.IsIPv6String(podIP) {
+				addressType = discoveryv1.AddressTypeIPv6
+			}
+			ready := true
+			portName := "http"
+			portNumber := int32(8080)
+			protocol := corev1.ProtocolTCP
+			sliceClient := oc.AdminKubeClient().DiscoveryV1().EndpointSlices(ns)
+			_, err = sliceClient.Create(context.Background(), &discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "no-selector-manual",
+					Labels: map[string]string{
+						discoveryv1.LabelServiceName: "no-selector",
+						discoveryv1.LabelManagedBy:   "e2e.openshift.io",
+					},
+				},
+				AddressType: addressType,
+				Endpoints: []discoveryv1.Endpoint{
+					{
+						Addresses:  []string{podIP},
+						Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+					},
+				},
+				Ports: []discoveryv1.EndpointPort{
+					{
+						Name:     &portName,
+						Port:     &portNumber,
+						Protocol: &protocol,
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			expectStatus("no-selector", http.StatusOK)
+
+			g.By("deleting the manually managed endpointslice")
+			err = sliceClient.Delete(context.Background(), "no-selector-manual", metav1.DeleteOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			expectStatus("no-selector", http.StatusServiceUnavailable)
+
+			g.By("verifying that the route to the NodePort service is still served")
+			expectStatus("node-port", http.StatusOK)
+		})
+	})
+})
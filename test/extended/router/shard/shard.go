@@ -5,6 +5,8 @@ import (
 	"reflect"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -32,6 +34,11 @@ var ingressControllerNonDefaultAvailableConditions = []operatorv1.OperatorCondit
 	{Type: "Admitted", Status: operatorv1.ConditionTrue},
 }
 
+var ingressControllerPrivateAvailableConditions = []operatorv1.OperatorCondition{
+	{Type: operatorv1.IngressControllerAvailableConditionType, Status: operatorv1.ConditionTrue},
+	{Type: "Admitted", Status: operatorv1.ConditionTrue},
+}
+
 func DeployNewRouterShard(oc *exutil.CLI, timeout time.Duration, cfg Config) (string, error) {
 	jsonCfg, err := oc.AsAdmin().Run("process").Args("-f", cfg.FixturePath, "-p",
 		"NAMESPACE=openshift-ingress-operator",
@@ -48,6 +55,106 @@ func DeployNewRouterShard(oc *exutil.CLI, timeout time.Duration, cfg Config) (st
 	return jsonCfg, waitForIngressControllerCondition(oc, timeout, types.NamespacedName{Namespace: "openshift-ingress-operator", Name: oc.Namespace()}, ingressControllerNonDefaultAvailableConditions...)
 }
 
+// DeployNewPrivateRouterShard creates an ingresscontroller named cfg.Type
+// that serves cfg.Domain and only admits routes from namespaces labelled
+// type=cfg.Type.  The ingresscontroller uses the Private endpoint publishing
+// strategy, so its router is only reachable from within the cluster, and
+// cfg.FixturePath is not used.  The tweak functions are applied to the spec
+// before the ingresscontroller is created.
+func DeployNewPrivateRouterShard(oc *exutil.CLI, timeout time.Duration, cfg Config, tweaks ...func(*operatorv1.IngressControllerSpec)) (*operatorv1.IngressController, error) {
+	one := int32(1)
+	ic := &operatorv1.IngressController{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cfg.Type,
+			Namespace: "openshift-ingress-operator",
+		},
+		Spec: operatorv1.IngressControllerSpec{
+			Replicas: &one,
+			Domain:   cfg.Domain,
+			EndpointPublishingStrategy: &operatorv1.EndpointPublishingStrategy{
+				Type: operatorv1.PrivateStrategyType,
+			},
+			NodePlacement: &operatorv1.NodePlacement{
+				NodeSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"node-role.kubernetes.io/worker": ""},
+				},
+			},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"type": cfg.Type},
+			},
+		},
+	}
+	for _, tweak := range tweaks {
+		tweak(&ic.Spec)
+	}
+
+	ic, err := oc.AdminOperatorClient().OperatorV1().IngressControllers(ic.Namespace).Create(context.Background(), ic, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return ic, waitForIngressControllerCondition(oc, timeout, types.NamespacedName{Namespace: ic.Namespace, Name: ic.Name}, ingressControllerPrivateAvailableConditions...)
+}
+
+// DeleteRouterShard deletes the named ingresscontroller.  It is not an error
+// if the ingresscontroller does not exist.
+func DeleteRouterShard(oc *exutil.CLI, name string) error {
+	err := oc.AdminOperatorClient().OperatorV1().IngressControllers("openshift-ingress-operator").Delete(context.Background(), name, metav1.DeleteOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// GetRouterShardPods returns the running router pods of the named
+// ingresscontroller that are not being deleted.
+func GetRouterShardPods(oc *exutil.CLI, name string) ([]corev1.Pod, error) {
+	pods, err := oc.AdminKubeClient().CoreV1().Pods("openshift-ingress").List(context.Background(), metav1.ListOptions{
+		LabelSelector: "ingresscontroller.operator.openshift.io/deployment-ingresscontroller=" + name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var running []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning {
+			running = append(running, pod)
+		}
+	}
+	return running, nil
+}
+
+// WaitForRouterShardRollout waits until the router deployment of the named
+// ingresscontroller has rolled out its latest revision to every replica and
+// scaled down the pods of older revisions, which may still be terminating.
+// It returns the running pods of the new revision.
+func WaitForRouterShardRollout(oc *exutil.CLI, timeout time.Duration, name string) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	err := wait.PollImmediate(3*time.Second, timeout, func() (bool, error) {
+		deployment, err := oc.AdminKubeClient().AppsV1().Deployments("openshift-ingress").Get(context.Background(), "router-"+name, metav1.GetOptions{})
+		if err != nil {
+			e2e.Logf("failed to get router deployment of ingresscontroller %s: %v, retrying...", name, err)
+			return false, nil
+		}
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		status := deployment.Status
+		if status.ObservedGeneration < deployment.Generation || status.UpdatedReplicas != replicas || status.AvailableReplicas != replicas || status.Replicas != replicas {
+			e2e.Logf("router deployment of ingresscontroller %s has not rolled out yet: %d replicas, %d updated, %d available, retrying...", name, status.Replicas, status.UpdatedReplicas, status.AvailableReplicas)
+			return false, nil
+		}
+		pods, err = GetRouterShardPods(oc, name)
+		if err != nil {
+			e2e.Logf("failed to get router pods of ingresscontroller %s: %v, retrying...", name, err)
+			return false, nil
+		}
+		return len(pods) == int(replicas), nil
+	})
+	return pods, err
+}
+
 func operatorConditionMap(conditions ...operatorv1.OperatorCondition) map[string]string {
 	conds := map[string]string{}
 	for _, cond := range conditions {
@@ -0,0 +1,226 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc          *exutil.CLI
+		ns          string
+		routerImage string
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("router-", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-smuggling")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should reject oversized headers and ambiguous message framing instead of forwarding them", func() {
+			g.By("creating a backend that echoes the request headers and a route to it")
+			createHeaderEchoBackend(oc.KubeClient(), ns, "smuggling")
+			host := "smuggling.example.com"
+			_, err := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns).Create(context.Background(), &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "smuggling",
+					Labels: map[string]string{"select": "smuggling"},
+				},
+				Spec: routev1.RouteSpec{
+					Host: host,
+					To:   routev1.RouteTargetReference{Name: "smuggling"},
+					Port: &routev1.RoutePort{
+						TargetPort: intstr.FromInt(8676),
+					},
+				},
+			}, metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("deploying a router")
+			rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter("router-smuggling", routerImage, "select=smuggling"), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+			pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=router-smuggling"})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(pods.Items).To(o.HaveLen(1))
+			routerIP := pods.Items[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			req := httpprobe.Request{Host: host, Address: routerIP, Timeout: 15 * time.Second}
+
+			g.By("waiting for the route to respond")
+			_, err = prober.WaitForStatus(req, http.StatusOK, changeTimeoutSeconds*time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// message builds a raw request for path that asks the
+			// router to close the connection after its response.
+			message := func(method, path string, headers []string, body string) []byte {
+				lines := append([]string{
+					fmt.Sprintf("%s %s HTTP/1.1", method, path),
+					"Host: " + host,
+					"Connection: close",
+				}, headers...)
+				return []byte(strings.Join(lines, "\r\n") + "\r\n\r\n" + body)
+			}
+			// echoed parses the request line and headers that the
+			// backend echoed in resp, or returns nil if resp was not
+			// from the backend.  The headers are parsed as they were
+			// received, http.ReadRequest would drop the framing
+			// headers that are checked.
+			type echoedRequest struct {
+				path   string
+				header textproto.MIMEHeader
+			}
+			echoed := func(resp *httpprobe.Response) *echoedRequest {
+				if resp.StatusCode != http.StatusOK {
+					return nil
+				}
+				r := textproto.NewReader(bufio.NewReader(strings.NewReader(string(resp.Body))))
+				line, err := r.ReadLine()
+				o.Expect(err).NotTo(o.HaveOccurred(), "unexpected response from the backend: %q", resp.Body)
+				fields := strings.Fields(line)
+				o.Expect(fields).To(o.HaveLen(3), "unexpected response from the backend: %q", resp.Body)
+				header, err := r.ReadMIMEHeader()
+				o.Expect(err).NotTo(o.HaveOccurred(), "unexpected response from the backend: %q", resp.Body)
+				return &echoedRequest{path: fields[1], header: header}
+			}
+
+			g.By("checking that a well-formed raw request reaches the backend")
+			responses, err := prober.DoRaw(req, message(http.MethodGet, "/valid", nil, ""))
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(responses).To(o.HaveLen(1))
+			o.Expect(echoed(responses[0])).NotTo(o.BeNil())
+			o.Expect(echoed(responses[0]).path).To(o.Equal("/valid"))
+
+			// The router must answer these requests itself with an
+			// error, the backend must never see them.
+			for _, tc := range []struct {
+				name     string
+				message  []byte
+				statuses []int
+			}{
+				{
+					name:     "a header larger than the buffer of the router",
+					message:  message(http.MethodGet, "/oversized", []string{"X-Oversized: " + strings.Repeat("a", 64*1024)}, ""),
+					statuses: []int{http.StatusBadRequest, http.StatusRequestHeaderFieldsTooLarge},
+				},
+				{
+					name:     "conflicting Content-Length headers",
+					message:  message(http.MethodPost, "/conflicting-length", []string{"Content-Length: 5", "Content-Length: 6"}, "hello!"),
+					statuses: []int{http.StatusBadRequest},
+				},
+				{
+					name:     "a Content-Length header that is not a number",
+					message:  message(http.MethodPost, "/invalid-length", []string{"Content-Length: 5x"}, "hello"),
+					statuses: []int{http.StatusBadRequest},
+				},
+				{
+					name:     "whitespace between a header name and the colon",
+					message:  message(http.MethodPost, "/invalid-name", []string{"Transfer-Encoding : chunked"}, "0\r\n\r\n"),
+					statuses: []int{http.StatusBadRequest},
+				},
+			} {
+				g.By(fmt.Sprintf("sending a request with %s", tc.name))
+				responses, err := prober.DoRaw(req, tc.message)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(responses).To(o.HaveLen(1), "a request with %s", tc.name)
+				o.Expect(responses[0].StatusCode).To(o.BeElementOf(tc.statuses), "a request with %s; body: %q", tc.name, responses[0].Body)
+			}
+
+			// A request with both a Transfer-Encoding and a
+			// Content-Length header may be forwarded, but only with
+			// the chunked framing, and the request that hides in its
+			// body must not reach the backend.
+			smuggled := fmt.Sprintf("GET /smuggled HTTP/1.1\r\nHost: %s\r\n\r\n", host)
+			chunk := fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", len(smuggled), smuggled)
+			for _, tc := range []struct {
+				name    string
+				message []byte
+			}{
+				{
+					name:    "a Content-Length header that ends before the chunked body",
+					message: message(http.MethodPost, "/te-cl", []string{"Transfer-Encoding: chunked", "Content-Length: 4"}, chunk),
+				},
+				{
+					name:    "a chunked body that ends before the Content-Length header",
+					message: message(http.MethodPost, "/cl-te", []string{"Content-Length: " + fmt.Sprint(len("0\r\n\r\n"+smuggled)), "Transfer-Encoding: chunked"}, "0\r\n\r\n"+smuggled),
+				},
+				{
+					name:    "two Transfer-Encoding headers",
+					message: message(http.MethodPost, "/te-te", []string{"Transfer-Encoding: chunked", "Transfer-Encoding: identity", "Content-Length: 4"}, chunk),
+				},
+			} {
+				g.By(fmt.Sprintf("sending a request with %s", tc.name))
+				responses, err := prober.DoRaw(req, tc.message)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				for _, resp := range responses {
+					if resp.StatusCode == http.StatusBadRequest {
+						continue
+					}
+					forwarded := echoed(resp)
+					o.Expect(forwarded).NotTo(o.BeNil(), "unexpected status %d for a request with %s", resp.StatusCode, tc.name)
+					o.Expect(forwarded.path).NotTo(o.Equal("/smuggled"), "the router forwarded the request hidden in a request with %s", tc.name)
+					o.Expect(forwarded.header.Values("Content-Length")).To(o.BeEmpty(), "the router forwarded a request with %s with its Content-Length header; headers: %#v", tc.name, forwarded.header)
+				}
+			}
+		})
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	kapierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -24,6 +26,7 @@ import (
 
 	routev1 "github.com/openshift/api/route/v1"
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+	"github.com/openshift/origin/test/extended/router/haproxyconfig"
 	exutil "github.com/openshift/origin/test/extended/util"
 )
 
@@ -293,6 +296,226 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 				o.Expect(writes).To(o.BeNumerically("<", 5))
 			}()
 		})
+
+		g.It("keeps the status of every router when two routers admit the same routes", func() {
+			g.By("deploying two routers with different canonical hostnames")
+			canonicalHostnames := map[string]string{
+				"router-fence-a": "router-fence-a.example.com",
+				"router-fence-b": "router-fence-b.example.com",
+			}
+			for name, hostname := range canonicalHostnames {
+				rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter(name, routerImage, "fence=true", "--router-canonical-hostname="+hostname), metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+			}
+
+			g.By("creating multiple routes")
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			for i := 0; i < 5; i++ {
+				_, err := client.Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   fmt.Sprintf("%d", i),
+						Labels: map[string]string{"fence": "true"},
+					},
+					Spec: routev1.RouteSpec{
+						Host: fmt.Sprintf("route-%d.fence.example.com", i),
+						To:   routev1.RouteTargetReference{Name: "test"},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			// checkStatus returns the last transition time of every
+			// router's ingress of every route, or an error describing the
+			// first ingress that is missing or not admitted.
+			checkStatus := func() (map[string]metav1.Time, error) {
+				routes, err := client.List(context.Background(), metav1.ListOptions{LabelSelector: "fence=true"})
+				if err != nil {
+					return nil, err
+				}
+				transitions := map[string]metav1.Time{}
+				for i := range routes.Items {
+					route := &routes.Items[i]
+					for name, hostname := range canonicalHostnames {
+						ingress := findIngress(route, name)
+						switch {
+						case ingress == nil:
+							return nil, fmt.Errorf("route %s has no status from %s", route.Name, name)
+						case ingress.RouterCanonicalHostname != hostname:
+							return nil, fmt.Errorf("route %s has canonical hostname %q from %s, expected %q", route.Name, ingress.RouterCanonicalHostname, name, hostname)
+						case len(ingress.Conditions) == 0 || ingress.Conditions[0].Type != routev1.RouteAdmitted || ingress.Conditions[0].Status != corev1.ConditionTrue:
+							return nil, fmt.Errorf("route %s is not admitted by %s: %v", route.Name, name, ingress.Conditions)
+						case ingress.Conditions[0].LastTransitionTime == nil:
+							return nil, fmt.Errorf("route %s has no last transition time from %s", route.Name, name)
+						}
+						transitions[route.Name+"/"+name] = *ingress.Conditions[0].LastTransitionTime
+					}
+				}
+				return transitions, nil
+			}
+
+			g.By("waiting for both routers to admit every route")
+			var admitted map[string]metav1.Time
+			err := wait.Poll(time.Second, 2*time.Minute, func() (bool, error) {
+				var err error
+				admitted, err = checkStatus()
+				if err != nil {
+					e2e.Logf("%v, retrying...", err)
+					return false, nil
+				}
+				return true, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(admitted).To(o.HaveLen(10))
+
+			g.By("verifying that neither router erases the status of the other")
+			// A router that stomps on the status of the other makes the
+			// other re-admit the route, which shows as a missing entry or
+			// a new transition time.
+			deadline := time.Now().Add(30 * time.Second)
+			for time.Now().Before(deadline) {
+				transitions, err := checkStatus()
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(transitions).To(o.Equal(admitted), "the status of the routes flapped")
+				time.Sleep(2 * time.Second)
+			}
+		})
+
+		g.It("admits exactly one route when clients race to create routes for the same host", func() {
+			const (
+				clients = 10
+				host    = "contended.storm.example.com"
+			)
+
+			g.By("deploying a router for the contended routes")
+			rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter("router-storm", routerImage, "storm=true"), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			newRoute := func(name, host string) *routev1.Route {
+				return &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   name,
+						Labels: map[string]string{"storm": "true"},
+					},
+					Spec: routev1.RouteSpec{
+						Host: host,
+						To:   routev1.RouteTargetReference{Name: "test"},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}
+			}
+			// race runs create concurrently for every client and returns
+			// the error of each.
+			race := func(create func(i int) error) []error {
+				errs := make([]error, clients)
+				var wg sync.WaitGroup
+				start := make(chan struct{})
+				for i := 0; i < clients; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer g.GinkgoRecover()
+						defer wg.Done()
+						<-start
+						errs[i] = create(i)
+					}(i)
+				}
+				close(start)
+				wg.Wait()
+				return errs
+			}
+
+			g.By(fmt.Sprintf("racing %d clients to create the same route", clients))
+			errs := race(func(i int) error {
+				_, err := client.Create(context.Background(), newRoute("storm", "same-name.storm.example.com"), metav1.CreateOptions{})
+				return err
+			})
+			created := 0
+			for _, err := range errs {
+				switch {
+				case err == nil:
+					created++
+				case !kapierrs.IsAlreadyExists(err):
+					e2e.Failf("expected creating a duplicate route to fail with AlreadyExists, got: %v", err)
+				}
+			}
+			o.Expect(created).To(o.Equal(1), "exactly one client should create the route")
+
+			g.By(fmt.Sprintf("racing %d clients to create different routes for host %s", clients, host))
+			errs = race(func(i int) error {
+				_, err := client.Create(context.Background(), newRoute(fmt.Sprintf("storm-%d", i), host), metav1.CreateOptions{})
+				return err
+			})
+			for _, err := range errs {
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By("waiting for the router to admit exactly one of the contending routes")
+			var winner string
+			err = wait.Poll(time.Second, 2*time.Minute, func() (bool, error) {
+				routes, err := client.List(context.Background(), metav1.ListOptions{LabelSelector: "storm=true"})
+				if err != nil {
+					return false, err
+				}
+				var admitted, rejected []string
+				for i := range routes.Items {
+					route := &routes.Items[i]
+					if route.Spec.Host != host {
+						continue
+					}
+					ingress := findIngress(route, "router-storm")
+					if ingress == nil || len(ingress.Conditions) == 0 || ingress.Conditions[0].Type != routev1.RouteAdmitted {
+						e2e.Logf("route %s has no status from the router yet", route.Name)
+						return false, nil
+					}
+					condition := ingress.Conditions[0]
+					switch {
+					case condition.Status == corev1.ConditionTrue:
+						admitted = append(admitted, route.Name)
+					case condition.Reason == "HostAlreadyClaimed":
+						rejected = append(rejected, route.Name)
+					default:
+						return false, fmt.Errorf("route %s was rejected for an unexpected reason: %s: %s", route.Name, condition.Reason, condition.Message)
+					}
+				}
+				if len(admitted)+len(rejected) != clients {
+					return false, nil
+				}
+				if len(admitted) != 1 {
+					e2e.Logf("routes %v are all admitted for %s, retrying...", admitted, host)
+					return false, nil
+				}
+				winner = admitted[0]
+				return true, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By(fmt.Sprintf("checking that only the backends of the admitted routes %s and storm are configured", winner))
+			pods, err := oc.KubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=router-storm"})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(pods.Items).To(o.HaveLen(1))
+			expected := []string{haproxyconfig.BackendName("", ns, "storm"), haproxyconfig.BackendName("", ns, winner)}
+			var backends []string
+			err = wait.PollImmediate(time.Second, time.Minute, func() (bool, error) {
+				config, err := getRouterConfig(ns, pods.Items[0].Name)
+				if err != nil {
+					e2e.Logf("%v, retrying...", err)
+					return false, nil
+				}
+				backends = nil
+				for _, backend := range config.Backends(haproxyconfig.BackendName("", ns, "")) {
+					backends = append(backends, backend.Name)
+				}
+				return o.ConsistOf(expected).Match(backends)
+			})
+			o.Expect(err).NotTo(o.HaveOccurred(), "haproxy has backends %v, expected %v", backends, expected)
+		})
 	})
 })
 
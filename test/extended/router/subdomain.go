@@ -3,6 +3,7 @@ package router
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -18,6 +19,8 @@ import (
 
 	routev1 "github.com/openshift/api/route/v1"
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
 	exutil "github.com/openshift/origin/test/extended/util"
 )
 
@@ -214,5 +217,82 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 				}
 			}
 		})
+
+		g.It("should serve a subdomain route on the host that each shard generates for it", func() {
+			g.By("creating a backend, a subdomain route and a route with a host")
+			createNetexecBackend(oc.KubeClient(), ns, "subdomain")
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			for _, route := range []routev1.Route{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "subdomain"},
+					Spec:       routev1.RouteSpec{Subdomain: "app"},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "host"},
+					Spec:       routev1.RouteSpec{Host: "host.subdomain.example.com"},
+				},
+			} {
+				route.Labels = map[string]string{"select": "subdomain"}
+				route.Spec.To = routev1.RouteTargetReference{Name: "subdomain"}
+				route.Spec.Port = &routev1.RoutePort{TargetPort: intstr.FromInt(8080)}
+				_, err := client.Create(context.Background(), &route, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By("deploying two router shards with distinct domains")
+			shards := map[string]string{
+				"router-shard-a": "a.subdomain.example.com",
+				"router-shard-b": "b.subdomain.example.com",
+			}
+			routerIPs := map[string]string{}
+			for name, domain := range shards {
+				rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter(name, routerImage, "select=subdomain", "--router-domain="+domain), metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+				pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=" + name})
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(pods.Items).To(o.HaveLen(1))
+				routerIPs[name] = pods.Items[0].Status.PodIP
+			}
+
+			g.By("waiting for each shard to write the host that it generated into the status of the subdomain route")
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			for name, domain := range shards {
+				host, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, "subdomain", name, true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "shard %s did not admit the subdomain route", name)
+				o.Expect(host).To(o.Equal("app."+domain), "shard %s", name)
+				host, err = waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, "host", name, true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "shard %s did not admit the route with a host", name)
+				o.Expect(host).To(o.Equal("host.subdomain.example.com"), "shard %s", name)
+			}
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+
+			for name, domain := range shards {
+				request := func(host string) httpprobe.Request {
+					return httpprobe.Request{Host: host, Address: routerIPs[name], Path: "/echo?msg=" + name, Timeout: 15 * time.Second}
+				}
+				g.By(fmt.Sprintf("checking that shard %s serves the subdomain route on its own host only", name))
+				resp, err := prober.WaitForStatus(request("app."+domain), http.StatusOK, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				o.Expect(string(resp.Body)).To(o.Equal(name))
+				for other, otherDomain := range shards {
+					if other == name {
+						continue
+					}
+					resp, err := prober.Do(request("app." + otherDomain))
+					o.Expect(err).NotTo(o.HaveOccurred())
+					o.Expect(resp.StatusCode).To(o.Equal(http.StatusServiceUnavailable), "shard %s served the host of shard %s", name, other)
+				}
+
+				g.By(fmt.Sprintf("checking that shard %s serves the route with a host", name))
+				_, err = prober.WaitForStatus(request("host.subdomain.example.com"), http.StatusOK, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+		})
 	})
 })
@@ -0,0 +1,232 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	t "github.com/onsi/ginkgo/extensions/table"
+	o "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+// tlsHandshake is a TLS version, and optionally a TLS 1.2 cipher suite, that
+// a client offers, and whether the router is expected to accept it.
+type tlsHandshake struct {
+	version  uint16
+	cipher   uint16
+	accepted bool
+}
+
+// tlsVersionNames names the TLS versions of tlsHandshake.
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+func (h tlsHandshake) String() string {
+	s := tlsVersionNames[h.version]
+	if h.cipher != 0 {
+		s += " with " + tls.CipherSuiteName(h.cipher)
+	}
+	return s
+}
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		reencryptConfigPath = exutil.FixturePath("testdata", "router", "reencrypt-serving-cert.yaml")
+
+		oc = exutil.NewCLI("router-tls-profiles")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		// The default certificate of a router shard has an RSA key, so
+		// the cipher suites are the ECDHE-RSA ones.  TLS 1.0 and 1.1
+		// are not checked for the Old profile because the crypto
+		// policy of the router image may disable them regardless.
+		t.DescribeTable("should only negotiate the TLS versions and ciphers of the tlsSecurityProfile of the ingresscontroller", func(profile *configv1.TLSSecurityProfile, handshakes []tlsHandshake) {
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			g.By("creating edge and reencrypt routes")
+			createNetexecBackend(oc.KubeClient(), ns, "tls-edge")
+			err = oc.Run("create").Args("-f", reencryptConfigPath).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+			e2e.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(oc.KubeClient(), "serving-cert", ns))
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			routes := map[string]*routev1.Route{
+				"tls-edge": {
+					ObjectMeta: metav1.ObjectMeta{Name: "tls-edge"},
+					Spec: routev1.RouteSpec{
+						Host: "tls-edge." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "tls-edge"},
+						Port: &routev1.RoutePort{TargetPort: intstr.FromInt(8080)},
+						TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+					},
+				},
+				"tls-reencrypt": {
+					ObjectMeta: metav1.ObjectMeta{Name: "tls-reencrypt"},
+					Spec: routev1.RouteSpec{
+						Host: "tls-reencrypt." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "serving-cert"},
+						TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationReencrypt},
+					},
+				},
+			}
+			for _, route := range routes {
+				_, err := routeClient.Routes(ns).Create(context.Background(), route, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By(fmt.Sprintf("creating a router shard with the %s TLS security profile", profile.Type))
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.TLSSecurityProfile = profile
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			for name := range routes {
+				_, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, name, shardName, true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q was not admitted", name)
+			}
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerIP := routerPods[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+
+			for name, route := range routes {
+				req := httpprobe.Request{Scheme: "https", Host: route.Spec.Host, Address: routerIP, Timeout: 15 * time.Second}
+				g.By(fmt.Sprintf("waiting for route %s to respond", name))
+				_, err := prober.WaitForStatus(req, http.StatusOK, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred())
+
+				for _, handshake := range handshakes {
+					g.By(fmt.Sprintf("offering %s to route %s", handshake, name))
+					req.MinVersion = handshake.version
+					req.MaxVersion = handshake.version
+					req.CipherSuites = nil
+					if handshake.cipher != 0 {
+						req.CipherSuites = []uint16{handshake.cipher}
+					}
+					resp, err := prober.Do(req)
+					if !handshake.accepted {
+						o.Expect(err).To(o.HaveOccurred(), "the router should reject %s", handshake)
+						continue
+					}
+					o.Expect(err).NotTo(o.HaveOccurred(), "the router should accept %s", handshake)
+					o.Expect(resp.StatusCode).To(o.Equal(http.StatusOK))
+					o.Expect(resp.TLS.Version).To(o.Equal(handshake.version))
+					if handshake.cipher != 0 {
+						o.Expect(resp.TLS.CipherSuite).To(o.Equal(handshake.cipher))
+					}
+				}
+			}
+		},
+			t.Entry("Old", &configv1.TLSSecurityProfile{
+				Type: configv1.TLSProfileOldType,
+				Old:  &configv1.OldTLSProfile{},
+			}, []tlsHandshake{
+				{version: tls.VersionTLS12, accepted: true},
+				{version: tls.VersionTLS13, accepted: true},
+				{version: tls.VersionTLS12, cipher: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, accepted: true},
+				{version: tls.VersionTLS12, cipher: tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, accepted: true},
+			}),
+			t.Entry("Intermediate", &configv1.TLSSecurityProfile{
+				Type:         configv1.TLSProfileIntermediateType,
+				Intermediate: &configv1.IntermediateTLSProfile{},
+			}, []tlsHandshake{
+				{version: tls.VersionTLS10, accepted: false},
+				{version: tls.VersionTLS11, accepted: false},
+				{version: tls.VersionTLS12, accepted: true},
+				{version: tls.VersionTLS13, accepted: true},
+				{version: tls.VersionTLS12, cipher: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, accepted: true},
+				{version: tls.VersionTLS12, cipher: tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, accepted: false},
+			}),
+			t.Entry("Modern", &configv1.TLSSecurityProfile{
+				Type:   configv1.TLSProfileModernType,
+				Modern: &configv1.ModernTLSProfile{},
+			}, []tlsHandshake{
+				{version: tls.VersionTLS10, accepted: false},
+				{version: tls.VersionTLS11, accepted: false},
+				{version: tls.VersionTLS12, accepted: false},
+				{version: tls.VersionTLS13, accepted: true},
+			}),
+			t.Entry("Custom", &configv1.TLSSecurityProfile{
+				Type: configv1.TLSProfileCustomType,
+				Custom: &configv1.CustomTLSProfile{
+					TLSProfileSpec: configv1.TLSProfileSpec{
+						Ciphers:       []string{"ECDHE-RSA-AES256-GCM-SHA384"},
+						MinTLSVersion: configv1.VersionTLS12,
+					},
+				},
+			}, []tlsHandshake{
+				{version: tls.VersionTLS11, accepted: false},
+				{version: tls.VersionTLS12, cipher: tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, accepted: true},
+				{version: tls.VersionTLS12, cipher: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, accepted: false},
+			}),
+		)
+	})
+})
@@ -0,0 +1,174 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		reencryptConfigPath = exutil.FixturePath("testdata", "router", "reencrypt-serving-cert.yaml")
+
+		oc = exutil.NewCLI("router-tuning-options")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should close idle connections at the timeouts of the tuningOptions of the ingresscontroller", func() {
+			// The timeouts differ from each other and from the
+			// defaults, so that each check can tell which timeout
+			// closed the connection.  The client timeout is also
+			// shorter than the fixed http-request timeout of 10s.
+			const (
+				clientTimeout = 4 * time.Second
+				serverTimeout = 6 * time.Second
+				tunnelTimeout = 8 * time.Second
+				// slack covers the latency of the exec relay.
+				slack = 4 * time.Second
+			)
+
+			ns := oc.Namespace()
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			g.By("creating an insecure route and a passthrough route")
+			createNetexecBackend(oc.KubeClient(), ns, "tuning-insecure")
+			err = oc.Run("create").Args("-f", reencryptConfigPath).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+			e2e.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(oc.KubeClient(), "serving-cert", ns))
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			routes := []*routev1.Route{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "tuning-insecure"},
+					Spec: routev1.RouteSpec{
+						Host: "tuning-insecure." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "tuning-insecure"},
+						Port: &routev1.RoutePort{TargetPort: intstr.FromInt(8080)},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "tuning-passthrough"},
+					Spec: routev1.RouteSpec{
+						Host: "tuning-passthrough." + shardFQDN,
+						To:   routev1.RouteTargetReference{Name: "serving-cert"},
+						TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough},
+					},
+				},
+			}
+			for _, route := range routes {
+				_, err := routeClient.Routes(ns).Create(context.Background(), route, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By(fmt.Sprintf("creating a router shard with a client timeout of %s, a server timeout of %s and a tunnel timeout of %s", clientTimeout, serverTimeout, tunnelTimeout))
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.TuningOptions.ClientTimeout = &metav1.Duration{Duration: clientTimeout}
+				spec.TuningOptions.ServerTimeout = &metav1.Duration{Duration: serverTimeout}
+				spec.TuningOptions.TunnelTimeout = &metav1.Duration{Duration: tunnelTimeout}
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+			for _, route := range routes {
+				_, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, route.Name, shardName, true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q was not admitted", route.Name)
+			}
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerIP := routerPods[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			insecure := httpprobe.Request{Host: "tuning-insecure." + shardFQDN, Address: routerIP, Timeout: time.Minute}
+			passthrough := httpprobe.Request{Scheme: "https", Host: "tuning-passthrough." + shardFQDN, Address: routerIP, Timeout: time.Minute}
+
+			g.By("waiting for the routes to respond")
+			for _, req := range []httpprobe.Request{insecure, passthrough} {
+				_, err := prober.WaitForStatus(req, http.StatusOK, changeTimeoutSeconds*time.Second)
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By("checking that a client that stops sending its request is disconnected at the client timeout")
+			elapsed, err := prober.TimeToClose(insecure, []byte(fmt.Sprintf("GET / HTTP/1.1\r\nHost: %s\r\n", insecure.Host)))
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(elapsed).To(o.BeNumerically("~", clientTimeout+slack/2, slack/2+time.Second), "the connection closed after %s", elapsed)
+
+			g.By("checking that a backend that does not respond times out at the server timeout")
+			req := insecure
+			req.Path = fmt.Sprintf("/shell?cmd=sleep%%20%d", int(2*serverTimeout/time.Second))
+			start := time.Now()
+			resp, err := prober.Do(req)
+			elapsed = time.Since(start)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(resp.StatusCode).To(o.Equal(http.StatusGatewayTimeout))
+			o.Expect(elapsed).To(o.BeNumerically("~", serverTimeout+slack/2, slack/2+time.Second), "the request took %s", elapsed)
+
+			// Once the passthrough connection is established with
+			// the backend it is a tunnel, so neither the client nor
+			// the server timeout applies to it.
+			g.By("checking that an idle passthrough connection is closed at the tunnel timeout")
+			elapsed, err = prober.TimeToClose(passthrough, nil)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(elapsed).To(o.BeNumerically("~", tunnelTimeout+slack/2, slack/2+time.Second), "the connection closed after %s", elapsed)
+		})
+	})
+})
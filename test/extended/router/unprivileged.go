@@ -16,14 +16,16 @@ import (
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 
 	exutil "github.com/openshift/origin/test/extended/util"
+	"github.com/openshift/origin/test/extended/util/certs"
 )
 
 var _ = g.Describe("[sig-network][Feature:Router]", func() {
 	defer g.GinkgoRecover()
 	var (
-		oc          *exutil.CLI
-		ns          string
-		routerImage string
+		oc                 *exutil.CLI
+		ns                 string
+		routerImage        string
+		defaultCertificate string
 	)
 
 	// this hook must be registered before the framework namespace teardown
@@ -47,6 +49,9 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 		routerImage, err = exutil.FindRouterImage(oc)
 		o.Expect(err).NotTo(o.HaveOccurred())
 
+		defaultCertificate, err = certs.NewDefaultCertificate("*.example.com")
+		o.Expect(err).NotTo(o.HaveOccurred())
+
 		configPath := exutil.FixturePath("testdata", "router", "router-common.yaml")
 		err = oc.AsAdmin().Run("new-app").Args("-f", configPath).Execute()
 		o.Expect(err).NotTo(o.HaveOccurred())
@@ -61,6 +66,7 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 				`-p=IMAGE=`+routerImage,
 				`-p=ROUTER_NAME=test-unprivileged`,
 				`-p=UPDATE_STATUS=false`,
+				`-p=DEFAULT_CERTIFICATE=`+defaultCertificate,
 			).Execute()
 			o.Expect(err).NotTo(o.HaveOccurred())
 
@@ -0,0 +1,244 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	t "github.com/onsi/ginkgo/extensions/table"
+	o "github.com/onsi/gomega"
+	"golang.org/x/net/websocket"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/httpprobe"
+	"github.com/openshift/origin/test/extended/router/routerstats"
+	exutil "github.com/openshift/origin/test/extended/util"
+	"github.com/openshift/origin/test/extended/util/image"
+)
+
+// websocketTimeout bounds the handshake of a websocket and each message
+// exchange on it.
+const websocketTimeout = 30 * time.Second
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		configPath  = exutil.FixturePath("testdata", "router", "router-websocket.yaml")
+		oc          *exutil.CLI
+		ns          string
+		routerImage string
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			exutil.DumpPodLogsStartingWith("router-", oc)
+			exutil.DumpPodLogsStartingWith("websocket", oc)
+		}
+	})
+
+	oc = exutil.NewCLI("router-websocket")
+
+	g.BeforeEach(func() {
+		ns = oc.Namespace()
+
+		var err error
+		routerImage, err = exutil.FindRouterImage(oc)
+		o.Expect(err).NotTo(o.HaveOccurred())
+
+		_, err = oc.AdminKubeClient().RbacV1().RoleBindings(ns).Create(context.Background(), &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "router",
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "default",
+				},
+			},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "ClusterRole",
+				Name: "system:router",
+			},
+		}, metav1.CreateOptions{})
+		o.Expect(err).NotTo(o.HaveOccurred())
+	})
+
+	g.Describe("The HAProxy router", func() {
+		t.DescribeTable("should upgrade and echo on websocket connections that survive reloads", func(termination routev1.TLSTerminationType, targetPort string) {
+			g.By("creating a websocket echo backend")
+			err := oc.Run("new-app").Args("-f", configPath, "-p", "IMAGE="+image.ShellImage()).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+			e2e.ExpectNoError(e2epod.WaitForPodNameRunningInNamespace(oc.KubeClient(), "websocket", ns))
+
+			// The router does not know the service CA, so reencrypt
+			// routes carry it to verify the serving certificate of the
+			// backend.
+			var destinationCA string
+			if termination == routev1.TLSTerminationReencrypt {
+				destinationCA, err = waitForServiceCA(oc, ns)
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			host := "websocket.example.com"
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			createRoute := func(name, host string) {
+				_, err := routeClient.Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   name,
+						Labels: map[string]string{"select": "websocket"},
+					},
+					Spec: routev1.RouteSpec{
+						Host: host,
+						To:   routev1.RouteTargetReference{Name: "websocket"},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromString(targetPort),
+						},
+						TLS: &routev1.TLSConfig{
+							Termination:              termination,
+							DestinationCACertificate: destinationCA,
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+			g.By(fmt.Sprintf("creating a %s route to the backend", termination))
+			createRoute("websocket", host)
+
+			g.By("deploying a router")
+			rs, err := oc.AdminKubeClient().AppsV1().ReplicaSets(ns).Create(context.Background(), labelSelectingRouter("router-websocket", routerImage, "select=websocket"), metav1.CreateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(waitForReadyReplicaSet(oc.KubeClient(), ns, rs.Name)).NotTo(o.HaveOccurred())
+			pods, err := oc.AdminKubeClient().CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{LabelSelector: "app=router-websocket"})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(pods.Items).To(o.HaveLen(1))
+			routerIP := pods.Items[0].Status.PodIP
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+			prober := httpprobe.New(oc.AdminKubeClient(), oc.AdminConfig(), ns, execPod.Name)
+			statsClient := routerstats.ForTestRouter(ns, execPod.Name, routerIP)
+
+			g.By("waiting for the route to respond")
+			_, err = prober.WaitForStatus(httpprobe.Request{Scheme: "https", Host: host, Address: routerIP}, http.StatusOK, changeTimeoutSeconds*time.Second)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("opening a websocket through the route")
+			ws, err := dialWebsocket(prober, routerIP, host)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			defer ws.Close()
+			o.Expect(websocketEcho(ws, "hello")).NotTo(o.HaveOccurred())
+
+			for i := 0; i < 3; i++ {
+				reloads, err := routerReloads(statsClient)
+				o.Expect(err).NotTo(o.HaveOccurred())
+
+				g.By(fmt.Sprintf("adding a route to make the router reload (#%d)", i+1))
+				createRoute(fmt.Sprintf("websocket-reload-%d", i), fmt.Sprintf("websocket-reload-%d.example.com", i))
+				err = wait.PollImmediate(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+					current, err := routerReloads(statsClient)
+					if err != nil {
+						e2e.Logf("unable to read the router reloads: %v", err)
+						return false, nil
+					}
+					return current > reloads, nil
+				})
+				o.Expect(err).NotTo(o.HaveOccurred(), "the router did not reload")
+
+				g.By("checking that the websocket that was open during the reload still echoes")
+				o.Expect(websocketEcho(ws, fmt.Sprintf("after reload %d", i+1))).NotTo(o.HaveOccurred())
+			}
+
+			g.By("checking that a new websocket can be opened after the reloads")
+			ws2, err := dialWebsocket(prober, routerIP, host)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			defer ws2.Close()
+			o.Expect(websocketEcho(ws2, "hello again")).NotTo(o.HaveOccurred())
+		},
+			t.Entry("edge", routev1.TLSTerminationEdge, "http"),
+			t.Entry("reencrypt", routev1.TLSTerminationReencrypt, "https"),
+		)
+	})
+})
+
+// dialWebsocket opens a websocket to the echo path of host over https
+// through the router at routerIP.
+func dialWebsocket(prober *httpprobe.Prober, routerIP, host string) (*websocket.Conn, error) {
+	conn, err := prober.Dial(context.Background(), routerIP, 443)
+	if err != nil {
+		return nil, err
+	}
+	config, err := websocket.NewConfig(fmt.Sprintf("wss://%s/echo", host), fmt.Sprintf("https://%s", host))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var ws *websocket.Conn
+	err = withConnTimeout(conn, func() error {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		ws, err = websocket.NewClient(config, tlsConn)
+		return err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open a websocket to %s: %v", host, err)
+	}
+	return ws, nil
+}
+
+// websocketEcho sends msg on ws and expects the backend to echo it.
+func websocketEcho(ws *websocket.Conn, msg string) error {
+	return withConnTimeout(ws, func() error {
+		if err := websocket.Message.Send(ws, msg); err != nil {
+			return fmt.Errorf("failed to send %q: %v", msg, err)
+		}
+		var reply string
+		if err := websocket.Message.Receive(ws, &reply); err != nil {
+			return fmt.Errorf("failed to receive the echo of %q: %v", msg, err)
+		}
+		if reply != msg {
+			return fmt.Errorf("expected the echo %q, got %q", msg, reply)
+		}
+		return nil
+	})
+}
+
+// withConnTimeout runs fn, closing conn if fn does not return within
+// websocketTimeout.  Connections through an exec pod do not support
+// deadlines.
+func withConnTimeout(conn io.Closer, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(websocketTimeout):
+		conn.Close()
+		return fmt.Errorf("timed out after %s", websocketTimeout)
+	}
+}
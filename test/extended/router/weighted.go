@@ -2,12 +2,9 @@ package router
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
 	"net"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	g "github.com/onsi/ginkgo"
@@ -19,7 +16,12 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/haproxyconfig"
+	"github.com/openshift/origin/test/extended/router/routerstats"
 	exutil "github.com/openshift/origin/test/extended/util"
+	"github.com/openshift/origin/test/extended/util/certs"
 )
 
 var _ = g.Describe("[sig-network][Feature:Router]", func() {
@@ -32,7 +34,9 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 	g.BeforeEach(func() {
 		routerImage, err := exutil.FindRouterImage(oc)
 		o.Expect(err).NotTo(o.HaveOccurred())
-		err = oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage).Execute()
+		defaultCertificate, err := certs.NewDefaultCertificate("*.example.com")
+		o.Expect(err).NotTo(o.HaveOccurred())
+		err = oc.AsAdmin().Run("new-app").Args("-f", configPath, "-p", "IMAGE="+routerImage, "-p", "DEFAULT_CERTIFICATE="+defaultCertificate).Execute()
 		o.Expect(err).NotTo(o.HaveOccurred())
 	})
 
@@ -71,11 +75,10 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 			routerURL := fmt.Sprintf("http://%s", routerIP)
 
 			g.By("waiting for the healthz endpoint to respond")
-			healthzURI := fmt.Sprintf("http://%s/healthz", net.JoinHostPort(routerIP, "1936"))
-			err = waitForRouterOKResponseExec(ns, execPod.Name, healthzURI, routerIP, changeTimeoutSeconds)
+			statsClient := routerstats.ForTestRouter(ns, execPod.Name, routerIP)
+			err = statsClient.WaitForHealthz(changeTimeoutSeconds * time.Second)
 			o.Expect(err).NotTo(o.HaveOccurred())
 
-			host := "weighted.example.com"
 			times := 100
 			g.By(fmt.Sprintf("checking that %d requests go through successfully", times))
 			// wait for the request to stabilize
@@ -86,20 +89,18 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			g.By(fmt.Sprintf("checking that there are three weighted backends in the router stats"))
-			var trafficValues []string
+			var servers []routerstats.Row
 			err = wait.PollImmediate(100*time.Millisecond, changeTimeoutSeconds*time.Second, func() (bool, error) {
-				statsURL := fmt.Sprintf("http://%s/;csv", net.JoinHostPort(routerIP, "1936"))
-				stats, err := getAuthenticatedRouteURLViaPod(ns, execPod.Name, statsURL, host, "admin", "password")
+				stats, err := statsClient.Stats()
 				o.Expect(err).NotTo(o.HaveOccurred())
-				trafficValues, err = parseStats(stats, "weightedroute", 7)
-				o.Expect(err).NotTo(o.HaveOccurred())
-				return len(trafficValues) == 3, nil
+				servers = stats.Servers(haproxyconfig.BackendName("", ns, "weightedroute"))
+				return len(servers) == 3, nil
 			})
 			o.Expect(err).NotTo(o.HaveOccurred())
 
-			trafficEP1, err := strconv.Atoi(trafficValues[0])
+			trafficEP1, err := servers[0].Int("stot")
 			o.Expect(err).NotTo(o.HaveOccurred())
-			trafficEP2, err := strconv.Atoi(trafficValues[1])
+			trafficEP2, err := servers[1].Int("stot")
 			o.Expect(err).NotTo(o.HaveOccurred())
 
 			weightedRatio := float32(trafficEP1) / float32(trafficEP2)
@@ -108,29 +109,89 @@ var _ = g.Describe("[sig-network][Feature:Router]", func() {
 			}
 
 			g.By(fmt.Sprintf("checking that zero weights are also respected by the router"))
-			host = "zeroweight.example.com"
+			host := "zeroweight.example.com"
 			err = expectRouteStatusCodeExec(ns, execPod.Name, routerURL, host, http.StatusServiceUnavailable)
 			o.Expect(err).NotTo(o.HaveOccurred())
 		})
+
+		g.It("should split the traffic of a route between its backends by weight", func() {
+			defer func() {
+				if g.CurrentGinkgoTestDescription().Failed {
+					dumpWeightedRouterLogs(oc, g.CurrentGinkgoTestDescription().FullTestText)
+				}
+			}()
+
+			ns := oc.KubeFramework().Namespace.Name
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			routerIP, err := waitForPodIP(oc, "weighted-router")
+			o.Expect(err).NotTo(o.HaveOccurred())
+			routerURL := fmt.Sprintf("http://%s", net.JoinHostPort(routerIP, "80"))
+			host := "weighted.example.com"
+
+			// endpoint-1 backs weightedendpoints1, the service with
+			// weight 90, and endpoint-2 and endpoint-3 back
+			// weightedendpoints2, the alternate backend with weight 10.
+			backendShare := func(samples int) (float64, error) {
+				codes, hostnames, err := routeResponsesExec(ns, execPod.Name, routerURL+"/hostname", host, samples)
+				if err != nil {
+					return 0, err
+				}
+				primary := 0
+				for i, code := range codes {
+					if code != "200" {
+						return 0, fmt.Errorf("unexpected status code %s from %s", code, hostnames[i])
+					}
+					if hostnames[i] == "endpoint-1" {
+						primary++
+					}
+				}
+				return float64(primary) / float64(samples), nil
+			}
+
+			g.By("waiting for the route to respond")
+			err = waitForRouterOKResponseExec(ns, execPod.Name, routerURL, host, changeTimeoutSeconds)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// With 300 samples the standard deviation of a 90% share
+			// is under 2%, so the tolerance is more than three
+			// standard deviations.
+			samples := 300
+			g.By(fmt.Sprintf("checking that %d requests are split 90/10 between the backends", samples))
+			share, err := backendShare(samples)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			e2e.Logf("the primary backend served %.1f%% of %d requests", 100*share, samples)
+			o.Expect(share).To(o.BeNumerically("~", 0.9, 0.07))
+
+			g.By("setting the weight of the alternate backend to 0")
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(ns)
+			route, err := client.Get(context.Background(), "weightedroute", metav1.GetOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			zero := int32(0)
+			route.Spec.AlternateBackends[0].Weight = &zero
+			_, err = client.Update(context.Background(), route, metav1.UpdateOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			g.By("checking that the alternate backend is out of rotation")
+			err = wait.PollImmediate(2*time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+				share, err := backendShare(20)
+				if err != nil {
+					e2e.Logf("unable to sample the route: %v", err)
+					return false, nil
+				}
+				return share == 1, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred(), "the alternate backend still receives requests")
+			share, err = backendShare(samples)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(share).To(o.Equal(1.0), "the alternate backend with weight 0 should not receive requests")
+		})
 	})
 })
 
-func parseStats(stats string, backendSubstr string, statsField int) ([]string, error) {
-	r := csv.NewReader(strings.NewReader(stats))
-	records, err := r.ReadAll()
-	if err != nil {
-		return nil, err
-	}
-
-	fieldValues := make([]string, 0)
-	for _, rec := range records {
-		if strings.Contains(rec[0], backendSubstr) && !strings.Contains(rec[1], "BACKEND") {
-			fieldValues = append(fieldValues, rec[statsField])
-		}
-	}
-	return fieldValues, nil
-}
-
 func dumpWeightedRouterLogs(oc *exutil.CLI, name string) {
 	log, _ := pod.GetPodLogs(oc.AdminKubeClient(), oc.KubeFramework().Namespace.Name, "weighted-router", "router")
 	e2e.Logf("Weighted Router test %s logs:\n %s", name, log)
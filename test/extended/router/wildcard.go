@@ -0,0 +1,222 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	o "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/origin/test/extended/router/shard"
+	exutil "github.com/openshift/origin/test/extended/util"
+)
+
+var _ = g.Describe("[sig-network][Feature:Router]", func() {
+	defer g.GinkgoRecover()
+	var (
+		oc = exutil.NewCLI("router-wildcard")
+
+		shardName string // computed
+	)
+
+	// this hook must be registered before the framework namespace teardown
+	// hook
+	g.AfterEach(func() {
+		if g.CurrentGinkgoTestDescription().Failed {
+			client := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1().Routes(oc.Namespace())
+			if routes, _ := client.List(context.Background(), metav1.ListOptions{}); routes != nil {
+				outputIngress(routes.Items...)
+			}
+			if len(shardName) > 0 {
+				selector := labels.SelectorFromSet(labels.Set{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": shardName})
+				exutil.DumpPodsCommand(oc.AdminKubeClient(), "openshift-ingress", selector, "cat /var/lib/haproxy/conf/haproxy.config")
+			}
+		}
+		if len(shardName) > 0 {
+			if err := shard.DeleteRouterShard(oc, shardName); err != nil {
+				e2e.Logf("deleting ingress controller failed: %v\n", err)
+			}
+			shardName = ""
+		}
+	})
+
+	g.Describe("The HAProxy router", func() {
+		g.It("should admit and match wildcard routes only when the ingresscontroller allows wildcards", func() {
+			ns := oc.Namespace()
+			domain := "apps-test.example.com"
+
+			defaultDomain, err := getDefaultIngressClusterDomainName(oc, time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred(), "failed to find default domain name")
+			shardFQDN := ns + "." + defaultDomain
+
+			g.By("creating a backend for the wildcard route and one for a specific route")
+			createNetexecBackend(oc.KubeClient(), ns, "wildcard")
+			createNetexecBackend(oc.KubeClient(), ns, "specific")
+
+			// The new router shard is using a namespace selector so
+			// label this test namespace to match.
+			g.By("labelling the namespace")
+			err = oc.AsAdmin().Run("label").Args("namespace", ns, "type="+ns).Execute()
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			// A route with the Subdomain wildcard policy serves every
+			// host of the subdomain of its own host, so the wildcard
+			// route claims *.apps-test.example.com.
+			g.By(fmt.Sprintf("creating a wildcard route for *.%s and a route for specific.%s", domain, domain))
+			routeClient := routeclientset.NewForConfigOrDie(oc.AdminConfig()).RouteV1()
+			for _, route := range []struct {
+				name   string
+				policy routev1.WildcardPolicyType
+			}{
+				{name: "wildcard", policy: routev1.WildcardPolicySubdomain},
+				{name: "specific", policy: routev1.WildcardPolicyNone},
+			} {
+				_, err := routeClient.Routes(ns).Create(context.Background(), &routev1.Route{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: route.name,
+					},
+					Spec: routev1.RouteSpec{
+						Host:           route.name + "." + domain,
+						WildcardPolicy: route.policy,
+						To:             routev1.RouteTargetReference{Name: route.name},
+						Port: &routev1.RoutePort{
+							TargetPort: intstr.FromInt(8080),
+						},
+					},
+				}, metav1.CreateOptions{})
+				o.Expect(err).NotTo(o.HaveOccurred())
+			}
+
+			g.By("creating a router shard that allows wildcard routes")
+			ic, err := shard.DeployNewPrivateRouterShard(oc, 10*time.Minute, shard.Config{
+				Domain: shardFQDN,
+				Type:   ns,
+			}, func(spec *operatorv1.IngressControllerSpec) {
+				spec.RouteAdmission = &operatorv1.RouteAdmissionPolicy{
+					WildcardPolicy: operatorv1.WildcardPolicyAllowed,
+				}
+			})
+			if ic != nil {
+				shardName = ic.Name
+			}
+			o.Expect(err).NotTo(o.HaveOccurred(), "new router shard did not rollout")
+
+			for _, name := range []string{"wildcard", "specific"} {
+				_, err := waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, name, shardName, true)
+				o.Expect(err).NotTo(o.HaveOccurred(), "route %q was not admitted", name)
+			}
+
+			routerPods, err := shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+
+			execPod := exutil.CreateExecPodOrFail(oc.AdminKubeClient(), ns, "execpod")
+			defer func() {
+				oc.AdminKubeClient().CoreV1().Pods(ns).Delete(context.Background(), execPod.Name, *metav1.NewDeleteOptions(1))
+			}()
+
+			// The netexec backends respond to /hostname with the name
+			// of their pod, which is the name of their route.
+			routerURL := fmt.Sprintf("http://%s", net.JoinHostPort(routerPods[0].Status.PodIP, "80"))
+			for _, tc := range []struct {
+				host    string
+				backend string
+			}{
+				{host: "wildcard." + domain, backend: "wildcard"},
+				{host: "subdomain." + domain, backend: "wildcard"},
+				{host: "other-subdomain." + domain, backend: "wildcard"},
+				{host: "specific." + domain, backend: "specific"},
+			} {
+				g.By(fmt.Sprintf("checking that %s is served by the %s route", tc.host, tc.backend))
+				err := waitForRouterOKResponseExec(ns, execPod.Name, routerURL+"/echo?msg=ok", tc.host, changeTimeoutSeconds)
+				o.Expect(err).NotTo(o.HaveOccurred(), "%s never became reachable", tc.host)
+				codes, hostnames, err := routeResponsesExec(ns, execPod.Name, routerURL+"/hostname", tc.host, 5)
+				o.Expect(err).NotTo(o.HaveOccurred())
+				for i, code := range codes {
+					o.Expect(code).To(o.Equal("200"), "%s", tc.host)
+					o.Expect(hostnames[i]).To(o.Equal(tc.backend), "%s should be served by the %s route", tc.host, tc.backend)
+				}
+			}
+
+			g.By("disallowing wildcard routes on the router shard")
+			patch := fmt.Sprintf(`{"spec":{"routeAdmission":{"wildcardPolicy":%q}}}`, operatorv1.WildcardPolicyDisallowed)
+			_, err = oc.AdminOperatorClient().OperatorV1().IngressControllers("openshift-ingress-operator").Patch(context.Background(), shardName, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+			o.Expect(err).NotTo(o.HaveOccurred())
+			err = waitForRouterShardWildcards(oc, shardName, false)
+			o.Expect(err).NotTo(o.HaveOccurred(), "router shard that disallows wildcard routes did not rollout")
+
+			g.By("checking that the wildcard route is rejected and the specific route is still admitted")
+			err = wait.PollImmediate(time.Second, changeTimeoutSeconds*time.Second, func() (bool, error) {
+				route, err := routeClient.Routes(ns).Get(context.Background(), "wildcard", metav1.GetOptions{})
+				if err != nil {
+					return false, err
+				}
+				ingress := findIngress(route, shardName)
+				if ingress == nil || len(ingress.Conditions) == 0 || ingress.Conditions[0].Type != routev1.RouteAdmitted {
+					return false, nil
+				}
+				return ingress.Conditions[0].Status == corev1.ConditionFalse, nil
+			})
+			o.Expect(err).NotTo(o.HaveOccurred(), "the wildcard route was not rejected")
+			_, err = waitForAdmittedRoute(changeTimeoutSeconds*time.Second, routeClient, ns, "specific", shardName, true)
+			o.Expect(err).NotTo(o.HaveOccurred(), "the specific route is no longer admitted")
+
+			routerPods, err = shard.GetRouterShardPods(oc, shardName)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(routerPods).NotTo(o.BeEmpty())
+			routerURL = fmt.Sprintf("http://%s", net.JoinHostPort(routerPods[0].Status.PodIP, "80"))
+
+			err = waitForRouterOKResponseExec(ns, execPod.Name, routerURL+"/echo?msg=ok", "specific."+domain, changeTimeoutSeconds)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			for _, host := range []string{"wildcard." + domain, "subdomain." + domain} {
+				err = expectRouteStatusCodeExec(ns, execPod.Name, routerURL+"/echo?msg=ok", host, 503)
+				o.Expect(err).NotTo(o.HaveOccurred(), "%s should not be served once wildcards are disallowed", host)
+			}
+		})
+	})
+})
+
+// waitForRouterShardWildcards waits until the operator has updated the
+// router deployment of the named ingresscontroller for its wildcard policy
+// and the update has rolled out.
+func waitForRouterShardWildcards(oc *exutil.CLI, name string, allowed bool) error {
+	expected := strconv.FormatBool(allowed)
+	err := wait.PollImmediate(3*time.Second, 5*time.Minute, func() (bool, error) {
+		deployment, err := oc.AdminKubeClient().AppsV1().Deployments("openshift-ingress").Get(context.Background(), "router-"+name, metav1.GetOptions{})
+		if err != nil {
+			e2e.Logf("failed to get router deployment of ingresscontroller %s: %v, retrying...", name, err)
+			return false, nil
+		}
+		// The router disallows wildcard routes unless the variable is
+		// set.
+		value := "false"
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			for _, env := range container.Env {
+				if env.Name == "ROUTER_ALLOW_WILDCARD_ROUTES" {
+					value = env.Value
+				}
+			}
+		}
+		return value == expected, nil
+	})
+	if err != nil {
+		return fmt.Errorf("router deployment of ingresscontroller %s never set ROUTER_ALLOW_WILDCARD_ROUTES=%s: %v", name, expected, err)
+	}
+	_, err = shard.WaitForRouterShardRollout(oc, 10*time.Minute, name)
+	return err
+}
@@ -456,10 +456,12 @@
 // test/extended/testdata/router/router-http2.yaml
 // test/extended/testdata/router/router-idle.yaml
 // test/extended/testdata/router/router-metrics.yaml
+// test/extended/testdata/router/router-mtls.yaml
 // test/extended/testdata/router/router-override-domains.yaml
 // test/extended/testdata/router/router-override.yaml
 // test/extended/testdata/router/router-scoped.yaml
 // test/extended/testdata/router/router-shard.yaml
+// test/extended/testdata/router/router-websocket.yaml
 // test/extended/testdata/router/weighted-router.yaml
 // test/extended/testdata/run_policy/parallel-bc.yaml
 // test/extended/testdata/run_policy/serial-bc.yaml
@@ -48295,32 +48297,54 @@ parameters:
 - name: IMAGE
   value: openshift/origin-haproxy-router:latest
 objects:
-- apiVersion: v1
-  kind: Pod
+- apiVersion: apps/v1
+  kind: Deployment
   metadata:
     name: router-haproxy-cfgmgr
     labels:
       test: router-haproxy-cfgmgr
   spec:
-    terminationGracePeriodSeconds: 1
-    containers:
-    - name: router
-      image: ${IMAGE}
-      imagePullPolicy: IfNotPresent
-      env:
-      - name: POD_NAMESPACE
-        valueFrom:
-          fieldRef:
-            fieldPath: metadata.namespace
-      args: ["--namespace=$(POD_NAMESPACE)", "-v=4", "--haproxy-config-manager=true", "--blueprint-route-labels=select=hapcm-blueprint", "--labels=select=haproxy-cfgmgr", "--stats-password=password", "--stats-port=1936", "--stats-user=admin"]
-      hostNetwork: false
-      ports:
-      - containerPort: 80
-      - containerPort: 443
-      - containerPort: 1936
-        name: stats
-        protocol: TCP
-    serviceAccountName: default
+    replicas: 1
+    selector:
+      matchLabels:
+        test: router-haproxy-cfgmgr
+    template:
+      metadata:
+        labels:
+          test: router-haproxy-cfgmgr
+      spec:
+        terminationGracePeriodSeconds: 1
+        containers:
+        - name: router
+          image: ${IMAGE}
+          imagePullPolicy: IfNotPresent
+          env:
+          - name: POD_NAMESPACE
+            valueFrom:
+              fieldRef:
+                fieldPath: metadata.namespace
+          args: ["--namespace=$(POD_NAMESPACE)", "-v=4", "--haproxy-config-manager=true", "--blueprint-route-namespace=$(POD_NAMESPACE)", "--blueprint-route-labels=select=hapcm-blueprint", "--labels=select=haproxy-cfgmgr", "--stats-password=password", "--stats-port=1936", "--stats-user=admin"]
+          ports:
+          - containerPort: 80
+          - containerPort: 443
+          - containerPort: 1936
+            name: stats
+            protocol: TCP
+          # the router only reports ready once it has synced the routes
+          # and started haproxy
+          readinessProbe:
+            httpGet:
+              path: /healthz/ready
+              port: 1936
+            initialDelaySeconds: 5
+            periodSeconds: 2
+          livenessProbe:
+            httpGet:
+              path: /healthz
+              port: 1936
+            initialDelaySeconds: 10
+            periodSeconds: 10
+        serviceAccountName: default
 
 # ensure the router can access routes and endpoints
 - apiVersion: v1
@@ -48333,7 +48357,22 @@ objects:
   roleRef:
     name: system:router
 
-# blueprints for edge, reencrypt and passthrough routes with annotation(s)
+# blueprints for insecure, edge, reencrypt and passthrough routes with
+# annotation(s)
+- apiVersion: route.openshift.io/v1
+  kind: Route
+  metadata:
+    name: insecure-blueprint
+    labels:
+      test: router
+      select: hapcm-blueprint
+  spec:
+    host: insecure.blueprint.hapcm.test
+    to:
+      name: insecure-service
+      kind: Service
+    ports:
+    - targetPort: 8080
 - apiVersion: route.openshift.io/v1
   kind: Route
   metadata:
@@ -48434,6 +48473,22 @@ objects:
         name: http
       - containerPort: 100
         protocol: UDP
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: weighted-endpoint
+    labels:
+      test: haproxy-cfgmgr
+      endpoints: weighted-endpoint
+  spec:
+    terminationGracePeriodSeconds: 1
+    containers:
+    - name: test
+      image: k8s.gcr.io/e2e-test-images/agnhost:2.33
+      args: ["netexec"]
+      ports:
+      - containerPort: 8080
+        name: http
 - apiVersion: v1
   kind: Pod
   metadata:
@@ -48486,6 +48541,18 @@ objects:
       endpoints: insecure-endpoint
     ports:
     - port: 8080
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: weighted-service
+    labels:
+      test: router
+  spec:
+    selector:
+      test: haproxy-cfgmgr
+      endpoints: weighted-endpoint
+    ports:
+    - port: 8080
 - apiVersion: v1
   kind: Service
   metadata:
@@ -48564,6 +48631,27 @@ objects:
     to:
       name: secure-service
       kind: Service
+
+# route that splits its traffic between two services
+- apiVersion: route.openshift.io/v1
+  kind: Route
+  metadata:
+    name: weighted-route
+    labels:
+      test: haproxy-cfgmgr
+      select: haproxy-cfgmgr
+  spec:
+    host: weighted.hapcm.test
+    to:
+      name: insecure-service
+      kind: Service
+      weight: 1
+    alternateBackends:
+    - name: weighted-service
+      kind: Service
+      weight: 1
+    ports:
+    - targetPort: 8080
 `)
 
 func testExtendedTestdataRouterRouterConfigManagerYamlBytes() ([]byte, error) {
@@ -49522,6 +49610,149 @@ func testExtendedTestdataRouterRouterMetricsYaml() (*asset, error) {
 	return a, nil
 }
 
+var _testExtendedTestdataRouterRouterMtlsYaml = []byte(`apiVersion: template.openshift.io/v1
+kind: Template
+parameters:
+- name: IMAGE
+  value: openshift/origin-haproxy-router:latest
+- name: DEFAULT_CERTIFICATE
+- name: CLIENT_CA
+objects:
+
+# ensure the router can access routes and endpoints
+- apiVersion: v1
+  kind: RoleBinding
+  metadata:
+    name: system-router
+  subjects:
+  - kind: ServiceAccount
+    name: default
+  roleRef:
+    name: system:router
+
+# the CA that signs the certificates of the clients
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: router-mtls-ca
+  data:
+    ca.pem: |-
+      ${CLIENT_CA}
+
+# a router that requires client certificates
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: router-mtls
+    labels:
+      test: router-mtls
+  spec:
+    terminationGracePeriodSeconds: 1
+    containers:
+    - name: router
+      image: ${IMAGE}
+      imagePullPolicy: IfNotPresent
+      env:
+      - name: POD_NAMESPACE
+        valueFrom:
+          fieldRef:
+            fieldPath: metadata.namespace
+      - name: DEFAULT_CERTIFICATE
+        value: |-
+          ${DEFAULT_CERTIFICATE}
+      - name: ROUTER_MUTUAL_TLS_AUTH
+        value: required
+      - name: ROUTER_MUTUAL_TLS_AUTH_CA
+        value: /etc/pki/tls/client-ca/ca.pem
+      args:
+      - "--name=test-mtls"
+      - "--namespace=$(POD_NAMESPACE)"
+      - "--update-status=false"
+      - "-v=4"
+      - "--labels=select=mtls"
+      - "--stats-port=1936"
+      hostNetwork: false
+      ports:
+      - containerPort: 80
+      - containerPort: 443
+      - containerPort: 1936
+        name: stats
+        protocol: TCP
+      readinessProbe:
+        initialDelaySeconds: 10
+        httpGet:
+          path: /healthz/ready
+          port: 1936
+      volumeMounts:
+      - name: client-ca
+        mountPath: /etc/pki/tls/client-ca
+        readOnly: true
+    volumes:
+    - name: client-ca
+      configMap:
+        name: router-mtls-ca
+    serviceAccountName: default
+
+# a backend that echoes the request headers
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: mtls-echo
+    labels:
+      app: mtls-echo
+  spec:
+    terminationGracePeriodSeconds: 1
+    containers:
+    - image: image-registry.openshift-image-registry.svc:5000/openshift/tools:latest
+      name: echo
+      command:
+        - /usr/bin/socat
+        - TCP4-LISTEN:8676,reuseaddr,fork
+        - EXEC:'/bin/bash -c \"printf \\\"HTTP/1.0 200 OK\r\n\r\n\\\"; sed -e \\\"/^\r/q\\\"\"'
+      ports:
+      - containerPort: 8676
+        protocol: TCP
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: mtls-echo
+  spec:
+    selector:
+      app: mtls-echo
+    ports:
+      - port: 8676
+        name: echo
+        protocol: TCP
+- apiVersion: route.openshift.io/v1
+  kind: Route
+  metadata:
+    name: mtls-echo
+    labels:
+      select: mtls
+  spec:
+    host: mtls.example.com
+    tls:
+      termination: Edge
+    to:
+      kind: Service
+      name: mtls-echo
+`)
+
+func testExtendedTestdataRouterRouterMtlsYamlBytes() ([]byte, error) {
+	return _testExtendedTestdataRouterRouterMtlsYaml, nil
+}
+
+func testExtendedTestdataRouterRouterMtlsYaml() (*asset, error) {
+	bytes, err := testExtendedTestdataRouterRouterMtlsYamlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "test/extended/testdata/router/router-mtls.yaml", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _testExtendedTestdataRouterRouterOverrideDomainsYaml = []byte(`apiVersion: template.openshift.io/v1
 kind: Template
 parameters:
@@ -49922,6 +50153,180 @@ func testExtendedTestdataRouterRouterShardYaml() (*asset, error) {
 	return a, nil
 }
 
+var _testExtendedTestdataRouterRouterWebsocketYaml = []byte(`apiVersion: template.openshift.io/v1
+kind: Template
+parameters:
+- name: IMAGE
+objects:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: websocket
+  data:
+    # A websocket echo server that only needs the python standard library.
+    # It serves plain HTTP on 8080 and TLS on 8443 with the serving
+    # certificate of the service, and answers requests that do not ask for
+    # an upgrade with 200 so that the route can be polled for readiness.
+    server.py: |
+      import base64, hashlib, socket, ssl, struct, threading
+
+      GUID = b"258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+      def recv_exact(conn, n):
+          data = b""
+          while len(data) < n:
+              chunk = conn.recv(n - len(data))
+              if not chunk:
+                  raise EOFError()
+              data += chunk
+          return data
+
+      def send_frame(conn, opcode, payload):
+          header = bytes([0x80 | opcode])
+          if len(payload) < 126:
+              header += bytes([len(payload)])
+          elif len(payload) < 65536:
+              header += bytes([126]) + struct.pack(">H", len(payload))
+          else:
+              header += bytes([127]) + struct.pack(">Q", len(payload))
+          conn.sendall(header + payload)
+
+      def handshake(conn):
+          data = b""
+          while b"\r\n\r\n" not in data:
+              chunk = conn.recv(4096)
+              if not chunk:
+                  return False
+              data += chunk
+          headers = {}
+          for line in data.split(b"\r\n")[1:]:
+              if b":" in line:
+                  name, value = line.split(b":", 1)
+                  headers[name.strip().lower()] = value.strip()
+          key = headers.get(b"sec-websocket-key")
+          if key is None:
+              conn.sendall(b"HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+              return False
+          accept = base64.b64encode(hashlib.sha1(key + GUID).digest())
+          conn.sendall(b"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + b"\r\n\r\n")
+          return True
+
+      def echo(conn):
+          while True:
+              first, second = recv_exact(conn, 2)
+              opcode, length = first & 0x0f, second & 0x7f
+              if length == 126:
+                  length = struct.unpack(">H", recv_exact(conn, 2))[0]
+              elif length == 127:
+                  length = struct.unpack(">Q", recv_exact(conn, 8))[0]
+              mask = recv_exact(conn, 4) if second & 0x80 else b"\0\0\0\0"
+              payload = bytes(c ^ mask[i % 4] for i, c in enumerate(recv_exact(conn, length)))
+              if opcode == 0x8:
+                  send_frame(conn, 0x8, payload)
+                  return
+              if opcode == 0x9:
+                  send_frame(conn, 0xa, payload)
+                  continue
+              send_frame(conn, opcode, payload)
+
+      def handle(conn, context):
+          try:
+              if context is not None:
+                  conn = context.wrap_socket(conn, server_side=True)
+              if handshake(conn):
+                  echo(conn)
+          except Exception:
+              pass
+          finally:
+              conn.close()
+
+      def serve(port, context=None):
+          try:
+              listener = socket.socket(socket.AF_INET6, socket.SOCK_STREAM)
+              listener.setsockopt(socket.IPPROTO_IPV6, socket.IPV6_V6ONLY, 0)
+              address = "::"
+          except OSError:
+              listener = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
+              address = "0.0.0.0"
+          listener.setsockopt(socket.SOL_SOCKET, socket.SO_REUSEADDR, 1)
+          listener.bind((address, port))
+          listener.listen(64)
+          while True:
+              conn, _ = listener.accept()
+              threading.Thread(target=handle, args=(conn, context), daemon=True).start()
+
+      context = ssl.SSLContext(ssl.PROTOCOL_TLS_SERVER)
+      context.load_cert_chain("/etc/serving-cert/tls.crt", "/etc/serving-cert/tls.key")
+      threading.Thread(target=serve, args=(8443, context), daemon=True).start()
+      serve(8080)
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: websocket
+    annotations:
+      service.beta.openshift.io/serving-cert-secret-name: serving-cert-websocket
+  spec:
+    selector:
+      name: websocket
+    ports:
+      - name: https
+        protocol: TCP
+        port: 8443
+        targetPort: 8443
+      - name: http
+        protocol: TCP
+        port: 8080
+        targetPort: 8080
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: websocket
+    labels:
+      name: websocket
+  spec:
+    containers:
+    - image: ${IMAGE}
+      name: server
+      command: ["/bin/sh", "-c", "exec $(command -v python3 || command -v python) /etc/websocket/server.py"]
+      readinessProbe:
+        tcpSocket:
+          port: 8080
+        initialDelaySeconds: 2
+        periodSeconds: 5
+      ports:
+      - containerPort: 8443
+        protocol: TCP
+      - containerPort: 8080
+        protocol: TCP
+      volumeMounts:
+      - mountPath: /etc/serving-cert
+        name: cert
+      - mountPath: /etc/websocket
+        name: server
+    volumes:
+    - name: cert
+      secret:
+        secretName: serving-cert-websocket
+    - name: server
+      configMap:
+        name: websocket
+`)
+
+func testExtendedTestdataRouterRouterWebsocketYamlBytes() ([]byte, error) {
+	return _testExtendedTestdataRouterRouterWebsocketYaml, nil
+}
+
+func testExtendedTestdataRouterRouterWebsocketYaml() (*asset, error) {
+	bytes, err := testExtendedTestdataRouterRouterWebsocketYamlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "test/extended/testdata/router/router-websocket.yaml", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _testExtendedTestdataRouterWeightedRouterYaml = []byte(`apiVersion: template.openshift.io/v1
 kind: Template
 parameters:
@@ -53378,10 +53783,12 @@ var _bindata = map[string]func() (*asset, error){
 	"test/extended/testdata/router/router-http2.yaml":                                                        testExtendedTestdataRouterRouterHttp2Yaml,
 	"test/extended/testdata/router/router-idle.yaml":                                                         testExtendedTestdataRouterRouterIdleYaml,
 	"test/extended/testdata/router/router-metrics.yaml":                                                      testExtendedTestdataRouterRouterMetricsYaml,
+	"test/extended/testdata/router/router-mtls.yaml":                                                         testExtendedTestdataRouterRouterMtlsYaml,
 	"test/extended/testdata/router/router-override-domains.yaml":                                             testExtendedTestdataRouterRouterOverrideDomainsYaml,
 	"test/extended/testdata/router/router-override.yaml":                                                     testExtendedTestdataRouterRouterOverrideYaml,
 	"test/extended/testdata/router/router-scoped.yaml":                                                       testExtendedTestdataRouterRouterScopedYaml,
 	"test/extended/testdata/router/router-shard.yaml":                                                        testExtendedTestdataRouterRouterShardYaml,
+	"test/extended/testdata/router/router-websocket.yaml":                                                    testExtendedTestdataRouterRouterWebsocketYaml,
 	"test/extended/testdata/router/weighted-router.yaml":                                                     testExtendedTestdataRouterWeightedRouterYaml,
 	"test/extended/testdata/run_policy/parallel-bc.yaml":                                                     testExtendedTestdataRun_policyParallelBcYaml,
 	"test/extended/testdata/run_policy/serial-bc.yaml":                                                       testExtendedTestdataRun_policySerialBcYaml,
@@ -54133,10 +54540,12 @@ var _bintree = &bintree{nil, map[string]*bintree{
 					"router-http2.yaml":               {testExtendedTestdataRouterRouterHttp2Yaml, map[string]*bintree{}},
 					"router-idle.yaml":                {testExtendedTestdataRouterRouterIdleYaml, map[string]*bintree{}},
 					"router-metrics.yaml":             {testExtendedTestdataRouterRouterMetricsYaml, map[string]*bintree{}},
+					"router-mtls.yaml":                {testExtendedTestdataRouterRouterMtlsYaml, map[string]*bintree{}},
 					"router-override-domains.yaml":    {testExtendedTestdataRouterRouterOverrideDomainsYaml, map[string]*bintree{}},
 					"router-override.yaml":            {testExtendedTestdataRouterRouterOverrideYaml, map[string]*bintree{}},
 					"router-scoped.yaml":              {testExtendedTestdataRouterRouterScopedYaml, map[string]*bintree{}},
 					"router-shard.yaml":               {testExtendedTestdataRouterRouterShardYaml, map[string]*bintree{}},
+					"router-websocket.yaml":           {testExtendedTestdataRouterRouterWebsocketYaml, map[string]*bintree{}},
 					"weighted-router.yaml":            {testExtendedTestdataRouterWeightedRouterYaml, map[string]*bintree{}},
 				}},
 				"run_policy": {nil, map[string]*bintree{
@@ -0,0 +1,246 @@
+// Package certs mints certificate authorities, intermediates and leaf
+// certificates on the fly so that tests do not depend on static fixture
+// certificates that eventually expire.
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// KeyType is the type of key that a certificate is issued for.
+type KeyType string
+
+const (
+	// ECDSA selects a P-256 ECDSA key.  This is the default.
+	ECDSA KeyType = "ECDSA"
+	// RSA selects an RSA key of Options.RSABits bits.
+	RSA KeyType = "RSA"
+
+	// defaultRSABits is the size of RSA keys when Options.RSABits is
+	// unset.
+	defaultRSABits = 2048
+)
+
+// Options describes a certificate to mint.  The zero value yields an
+// ECDSA certificate that is valid from an hour ago until a day from now.
+type Options struct {
+	// CommonName is the subject common name.
+	CommonName string
+	// Organization is the subject organization.
+	Organization []string
+	// DNSNames and IPAddresses are the subject alternative names.
+	DNSNames    []string
+	IPAddresses []net.IP
+	// NotBefore and NotAfter bound the validity period.  Set NotAfter in
+	// the past to mint an expired certificate.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// KeyType is the type of key to generate.
+	KeyType KeyType
+	// RSABits is the RSA key size; it is ignored for ECDSA keys.
+	RSABits int
+	// ExtKeyUsage overrides the extended key usages of a leaf
+	// certificate, which default to server authentication.
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// Cert is a certificate together with its private key and the
+// certificate that issued it.
+type Cert struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	// Issuer is nil for a self-signed certificate authority.
+	Issuer *Cert
+}
+
+// NewCA returns a self-signed certificate authority.
+func NewCA(opts Options) (*Cert, error) {
+	if len(opts.CommonName) == 0 {
+		opts.CommonName = "Test Root CA"
+	}
+	return issue(nil, opts, true)
+}
+
+// NewIntermediate returns an intermediate certificate authority issued by
+// c.
+func (c *Cert) NewIntermediate(opts Options) (*Cert, error) {
+	if len(opts.CommonName) == 0 {
+		opts.CommonName = "Test Intermediate CA"
+	}
+	return issue(c, opts, true)
+}
+
+// NewLeaf returns a leaf certificate issued by c.  If opts has no common
+// name, the first DNS name is used.
+func (c *Cert) NewLeaf(opts Options) (*Cert, error) {
+	if len(opts.CommonName) == 0 && len(opts.DNSNames) > 0 {
+		opts.CommonName = opts.DNSNames[0]
+	}
+	return issue(c, opts, false)
+}
+
+func issue(issuer *Cert, opts Options, isCA bool) (*Cert, error) {
+	key, err := generateKey(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	notBefore, notAfter := opts.NotBefore, opts.NotAfter
+	if notBefore.IsZero() {
+		notBefore = time.Now().Add(-time.Hour)
+	}
+	if notAfter.IsZero() {
+		notAfter = time.Now().Add(24 * time.Hour)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   opts.CommonName,
+			Organization: opts.Organization,
+		},
+		DNSNames:              opts.DNSNames,
+		IPAddresses:           opts.IPAddresses,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		if _, ok := key.(*rsa.PrivateKey); ok {
+			template.KeyUsage |= x509.KeyUsageKeyEncipherment
+		}
+		template.ExtKeyUsage = opts.ExtKeyUsage
+		if len(template.ExtKeyUsage) == 0 {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		}
+	}
+
+	parent, signer := template, crypto.Signer(key)
+	if issuer != nil {
+		parent, signer = issuer.Certificate, issuer.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate %q: %v", opts.CommonName, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %q: %v", opts.CommonName, err)
+	}
+
+	return &Cert{Certificate: cert, Key: key, Issuer: issuer}, nil
+}
+
+func generateKey(opts Options) (crypto.Signer, error) {
+	switch opts.KeyType {
+	case "", ECDSA:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ECDSA key: %v", err)
+		}
+		return key, nil
+	case RSA:
+		bits := opts.RSABits
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %d-bit RSA key: %v", bits, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", opts.KeyType)
+	}
+}
+
+// CertPEM returns the certificate in PEM format, suitable for a route's
+// certificate or CA certificate stanza.
+func (c *Cert) CertPEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate.Raw}))
+}
+
+// KeyPEM returns the private key in PKCS #8 PEM format, suitable for a
+// route's key stanza.
+func (c *Cert) KeyPEM() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(c.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// ChainPEM returns the certificate followed by every intermediate that
+// leads to, but does not include, the root certificate authority.
+func (c *Cert) ChainPEM() string {
+	var chain strings.Builder
+	for cert := c; cert != nil && cert.Issuer != nil; cert = cert.Issuer {
+		chain.WriteString(cert.CertPEM())
+	}
+	if chain.Len() == 0 {
+		return c.CertPEM()
+	}
+	return chain.String()
+}
+
+// CombinedPEM returns the chain followed by the private key, the format
+// that the router expects for its default certificate.
+func (c *Cert) CombinedPEM() (string, error) {
+	key, err := c.KeyPEM()
+	if err != nil {
+		return "", err
+	}
+	return c.ChainPEM() + key, nil
+}
+
+// Root returns the certificate authority at the top of c's chain.
+func (c *Cert) Root() *Cert {
+	root := c
+	for root.Issuer != nil {
+		root = root.Issuer
+	}
+	return root
+}
+
+// CertPool returns a pool that trusts c's root certificate authority.
+func (c *Cert) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.Root().Certificate)
+	return pool
+}
+
+// NewDefaultCertificate mints a certificate authority and a leaf
+// certificate for hosts, and returns the leaf in the combined PEM format
+// that the router accepts as its default certificate.
+func NewDefaultCertificate(hosts ...string) (string, error) {
+	ca, err := NewCA(Options{})
+	if err != nil {
+		return "", err
+	}
+	leaf, err := ca.NewLeaf(Options{DNSNames: hosts})
+	if err != nil {
+		return "", err
+	}
+	return leaf.CombinedPEM()
+}
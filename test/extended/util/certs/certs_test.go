@@ -0,0 +1,104 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeafVerifiesThroughIntermediate(t *testing.T) {
+	ca, err := NewCA(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := ca.NewIntermediate(Options{KeyType: RSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := intermediate.NewLeaf(Options{DNSNames: []string{"www.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if leaf.Certificate.Subject.CommonName != "www.example.com" {
+		t.Errorf("expected the common name to default to the first DNS name, got %q", leaf.Certificate.Subject.CommonName)
+	}
+	if _, ok := intermediate.Key.(*rsa.PrivateKey); !ok {
+		t.Errorf("expected an RSA intermediate key, got %T", intermediate.Key)
+	}
+	if _, ok := leaf.Key.(*ecdsa.PrivateKey); !ok {
+		t.Errorf("expected an ECDSA leaf key, got %T", leaf.Key)
+	}
+
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate.Certificate)
+	if _, err := leaf.Certificate.Verify(x509.VerifyOptions{
+		DNSName:       "www.example.com",
+		Roots:         leaf.CertPool(),
+		Intermediates: intermediates,
+	}); err != nil {
+		t.Errorf("expected the leaf to verify: %v", err)
+	}
+
+	if n := strings.Count(leaf.ChainPEM(), "BEGIN CERTIFICATE"); n != 2 {
+		t.Errorf("expected the chain to hold the leaf and intermediate, got %d certificates", n)
+	}
+	if n := strings.Count(ca.ChainPEM(), "BEGIN CERTIFICATE"); n != 1 {
+		t.Errorf("expected the chain of a root to hold only the root, got %d certificates", n)
+	}
+}
+
+func TestExpiredLeaf(t *testing.T) {
+	ca, err := NewCA(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.NewLeaf(Options{
+		DNSNames:  []string{"expired.example.com"},
+		NotBefore: time.Now().Add(-48 * time.Hour),
+		NotAfter:  time.Now().Add(-24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = leaf.Certificate.Verify(x509.VerifyOptions{Roots: leaf.CertPool()})
+	if certErr, ok := err.(x509.CertificateInvalidError); !ok || certErr.Reason != x509.Expired {
+		t.Errorf("expected an expired certificate error, got %v", err)
+	}
+}
+
+func TestCombinedPEM(t *testing.T) {
+	combined, err := NewDefaultCertificate("www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair([]byte(combined), []byte(combined)); err != nil {
+		t.Errorf("expected a usable key pair: %v", err)
+	}
+
+	ca, err := NewCA(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.NewLeaf(Options{KeyType: RSA, RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := leaf.KeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(key))
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits := parsed.(*rsa.PrivateKey).N.BitLen(); bits != 1024 {
+		t.Errorf("expected a 1024-bit key, got %d bits", bits)
+	}
+}